@@ -0,0 +1,77 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/joehandzik/lustre_exporter/sources"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// checkCollection collects once from every source and writes a summary of
+// the series produced and errors seen to w. It returns an error if no
+// series were produced or the Lustre proc tree couldn't be read, which
+// usually means a path flag is wrong.
+func checkCollection(w io.Writer, sourceList map[string]sources.LustreSource, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(LustreSource{ctx: ctx, source_list: sourceList})
+	families, err := registry.Gather()
+	if err != nil {
+		return err
+	}
+
+	var series, sourceErrors int
+	lustreUp := true
+	scrapeDurationsName := prometheus.BuildFQName(sources.Namespace, "exporter", "scrape_duration_seconds")
+	for _, family := range families {
+		switch family.GetName() {
+		case scrapeDurationsName:
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "result" && label.GetValue() == "error" {
+						sourceErrors += int(metric.GetSummary().GetSampleCount())
+					}
+				}
+			}
+			continue
+		case prometheus.BuildFQName(sources.Namespace, "", "collector_duration_seconds"):
+			continue
+		case prometheus.BuildFQName(sources.Namespace, "", "up"):
+			for _, metric := range family.GetMetric() {
+				lustreUp = lustreUp && metric.GetGauge().GetValue() == 1
+			}
+		}
+		series += len(family.GetMetric())
+	}
+	var fileErrors int
+	for _, collectErr := range sources.CollectErrors() {
+		fileErrors += collectErr.Count
+	}
+
+	fmt.Fprintf(w, "check: %d series from %d sources, %d source errors, %d file errors\n", series, len(sourceList), sourceErrors, fileErrors)
+	if series == 0 {
+		return fmt.Errorf("no series were produced")
+	}
+	if !lustreUp {
+		return fmt.Errorf("the Lustre proc tree at %s couldn't be read", sources.ProcfsBasePath())
+	}
+	return nil
+}
@@ -14,10 +14,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -25,6 +28,7 @@ import (
 	"github.com/joehandzik/lustre_exporter/sources"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/log"
 	"github.com/prometheus/common/version"
 )
@@ -39,14 +43,54 @@ var (
 		},
 		[]string{"source", "result"},
 	)
+	collectorDurations = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: sources.Namespace,
+			Name:      "collector_duration_seconds",
+			Help:      "Distribution of the time taken by each source to collect its metrics.",
+			Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"source"},
+	)
+	inflightScrapes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: sources.Namespace,
+			Subsystem: "exporter",
+			Name:      "inflight_scrapes",
+			Help:      "Number of scrapes currently being served.",
+		},
+	)
+	scrapeConcurrency = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: sources.Namespace,
+			Subsystem: "exporter",
+			Name:      "scrape_concurrency",
+			Help:      "Number of sources collected in parallel for each scrape.",
+		},
+	)
+	collectorEnabled = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: sources.Namespace,
+			Subsystem: "exporter",
+			Name:      "collector_enabled",
+			Help:      "Whether the collector was enabled at startup (1) or not (0).",
+		},
+		[]string{"collector"},
+	)
 )
 
+// scrapeTimeoutOffset is subtracted from the timeout Prometheus advertises so
+// there is time left to send the response.
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
 type LustreSource struct {
+	ctx         context.Context
 	source_list map[string]sources.LustreSource
 }
 
 func (l LustreSource) Describe(ch chan<- *prometheus.Desc) {
 	scrapeDurations.Describe(ch)
+	collectorDurations.Describe(ch)
 }
 
 func (l LustreSource) Collect(ch chan<- prometheus.Metric) {
@@ -54,18 +98,19 @@ func (l LustreSource) Collect(ch chan<- prometheus.Metric) {
 	wg.Add(len(l.source_list))
 	for name, c := range l.source_list {
 		go func(name string, s sources.LustreSource) {
-			collectFromSource(name, c, ch)
+			collectFromSource(l.ctx, name, s, ch)
 			wg.Done()
 		}(name, c)
 	}
 	wg.Wait()
 	scrapeDurations.Collect(ch)
+	collectorDurations.Collect(ch)
 }
 
-func collectFromSource(name string, s sources.LustreSource, ch chan<- prometheus.Metric) {
+func collectFromSource(ctx context.Context, name string, s sources.LustreSource, ch chan<- prometheus.Metric) {
 	result := "success"
 	begin := time.Now()
-	err := s.Update(ch)
+	err := s.Update(ctx, ch)
 	duration := time.Since(begin)
 	if err != nil {
 		log.Errorf("ERROR: %q source failed after %f seconds: %s", name, duration.Seconds(), err)
@@ -74,6 +119,14 @@ func collectFromSource(name string, s sources.LustreSource, ch chan<- prometheus
 		log.Debugf("OK: %q source suceeded after %f seconds: %s", name, duration.Seconds(), err)
 	}
 	scrapeDurations.WithLabelValues(name, result).Observe(duration.Seconds())
+	collectorDurations.WithLabelValues(name).Observe(duration.Seconds())
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
 }
 
 func loadSources(list string) (map[string]sources.LustreSource, error) {
@@ -92,15 +145,84 @@ func loadSources(list string) (map[string]sources.LustreSource, error) {
 	return source_list, nil
 }
 
+// lustreHandler serves a scrape, returning 503 rather than a partial response
+// if the sources do not finish within the scrape timeout.
+type lustreHandler struct {
+	source_list map[string]sources.LustreSource
+	timeout     time.Duration
+	opts        promhttp.HandlerOpts
+}
+
+func (h lustreHandler) scrapeTimeout(r *http.Request) time.Duration {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return h.timeout
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil {
+		log.Warnf("Couldn't parse X-Prometheus-Scrape-Timeout-Seconds %q: %s", header, err)
+		return h.timeout
+	}
+	timeout := time.Duration(seconds*float64(time.Second)) - scrapeTimeoutOffset
+	if timeout <= 0 {
+		return h.timeout
+	}
+	return timeout
+}
+
+func (h lustreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	inflightScrapes.Inc()
+	defer inflightScrapes.Dec()
+
+	timeout := h.scrapeTimeout(r)
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(LustreSource{ctx: ctx, source_list: h.source_list})
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+
+	type gatherResult struct {
+		families []*dto.MetricFamily
+		err      error
+	}
+	done := make(chan gatherResult, 1)
+	go func() {
+		families, err := gatherers.Gather()
+		done <- gatherResult{families: families, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return result.families, result.err
+		})
+		promhttp.HandlerFor(gatherer, h.opts).ServeHTTP(w, r)
+	case <-ctx.Done():
+		log.Errorf("Scrape timed out after %s", timeout)
+		http.Error(w, fmt.Sprintf("Lustre metrics collection timed out after %s", timeout), http.StatusServiceUnavailable)
+	}
+}
+
 func init() {
 	prometheus.MustRegister(version.NewCollector("lustre_exporter"))
+	prometheus.MustRegister(collectorEnabled)
+	prometheus.MustRegister(inflightScrapes)
+	prometheus.MustRegister(scrapeConcurrency)
 }
 
 func main() {
 	var (
 		showVersion   = flag.Bool("version", false, "Print version information.")
-		listenAddress = flag.String("web.listen-address", ":9169", "Address to use to expose Lustre metrics.")
+		listenAddress = flag.String("web.listen-address", ":9169", "Address to use to expose Lustre metrics. Set to an empty string to only listen on --web.unix-socket.")
+		unixSocket    = flag.String("web.unix-socket", "", "Path of a Unix domain socket to also expose Lustre metrics on.")
 		metricsPath   = flag.String("web.telemetry-path", "/metrics", "Path to use to expose Lustre metrics.")
+		procDump      = flag.Bool("web.enable-proc-dump", false, "Serve raw Lustre proc file contents at /proc-dump?path=<path relative to the proc tree> for debugging.")
+		collectErrs   = flag.Bool("web.enable-collect-errors", false, "Serve the most recent file read and parse errors as JSON at /collect-errors.")
+		probe         = flag.String("probe-metric", "", "Collect once, print the series of this metric in the Prometheus text format, and exit. Exits nonzero if the metric produced no series.")
+		check         = flag.Bool("check", false, "Collect once, print a summary of the series produced and errors seen to stderr, and exit. Exits nonzero if no series were produced or the Lustre proc tree couldn't be read.")
+		lnetRouter    = flag.Bool("collector.lnet-router", false, "Collect the LNET routing table and router buffer pools, for LNET router nodes.")
+		scrapeTimeout = flag.Duration("web.scrape-timeout", 10*time.Second, "Maximum time to spend collecting metrics when Prometheus does not send X-Prometheus-Scrape-Timeout-Seconds.")
 	)
 	flag.Parse()
 
@@ -113,7 +235,10 @@ func main() {
 	log.Infoln("Build context", version.BuildContext())
 
 	//expand to include more sources eventually (CLI, other?)
-	enabledSources := "procfs"
+	enabledSources := "procfs,lnet"
+	if *lnetRouter {
+		enabledSources += ",lnet_router"
+	}
 
 	source_list, err := loadSources(enabledSources)
 	if err != nil {
@@ -124,11 +249,43 @@ func main() {
 	for s := range source_list {
 		log.Infof(" - %s", s)
 	}
+	for name := range sources.Factories {
+		_, enabled := source_list[name]
+		collectorEnabled.WithLabelValues(name).Set(boolToFloat(enabled))
+	}
+	for name, enabled := range sources.OptionalCollectors() {
+		collectorEnabled.WithLabelValues(name).Set(boolToFloat(enabled))
+	}
+	scrapeConcurrency.Set(float64(len(source_list)))
+
+	if *check {
+		if err := checkCollection(os.Stderr, source_list, *scrapeTimeout); err != nil {
+			log.Fatalf("Check failed: %s", err)
+		}
+		os.Exit(0)
+	}
+
+	if *probe != "" {
+		if err := probeMetric(os.Stdout, *probe, source_list, *scrapeTimeout); err != nil {
+			log.Fatalf("Probe failed: %s", err)
+		}
+		os.Exit(0)
+	}
 
-	prometheus.MustRegister(LustreSource{source_list: source_list})
-	handler := promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{ErrorLog: log.NewErrorLogger()})
+	handler := lustreHandler{
+		source_list: source_list,
+		timeout:     *scrapeTimeout,
+		opts:        promhttp.HandlerOpts{ErrorLog: log.NewErrorLogger()},
+	}
 
 	http.Handle(*metricsPath, prometheus.InstrumentHandler("prometheus", handler))
+	if *procDump {
+		log.Warnln("Serving raw proc file contents at /proc-dump")
+		http.Handle("/proc-dump", procDumpHandler{basePath: sources.ProcfsBasePath()})
+	}
+	if *collectErrs {
+		http.HandleFunc("/collect-errors", collectErrorsHandler)
+	}
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
 			<head><title>Lustre Exporter</title></head>
@@ -139,9 +296,41 @@ func main() {
 			</html>`))
 	})
 
+	if *listenAddress == "" && *unixSocket == "" {
+		log.Fatal("At least one of --web.listen-address and --web.unix-socket must be set")
+	}
+
+	if *unixSocket != "" {
+		listener, err := listenUnix(*unixSocket)
+		if err != nil {
+			log.Fatalf("Couldn't listen on Unix socket %q: %s", *unixSocket, err)
+		}
+		log.Infoln("Listening on Unix socket", *unixSocket)
+		if *listenAddress == "" {
+			log.Fatal(http.Serve(listener, nil))
+		}
+		go func() {
+			log.Fatal(http.Serve(listener, nil))
+		}()
+	}
+
 	log.Infoln("Listening on", *listenAddress)
 	err = http.ListenAndServe(*listenAddress, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+// listenUnix listens on the Unix domain socket at path, removing a stale
+// socket left behind by a previous run.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
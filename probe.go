@@ -0,0 +1,52 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/joehandzik/lustre_exporter/sources"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// probeMetric collects once from every source and writes the series of the
+// named metric to w in the Prometheus text format. The name may be given
+// with or without the lustre_ prefix. It returns an error if the metric
+// produced no series.
+func probeMetric(w io.Writer, name string, sourceList map[string]sources.LustreSource, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(LustreSource{ctx: ctx, source_list: sourceList})
+	families, err := registry.Gather()
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if family.GetName() != name && family.GetName() != sources.Namespace+"_"+name {
+			continue
+		}
+		if len(family.GetMetric()) == 0 {
+			break
+		}
+		_, err := expfmt.MetricFamilyToText(w, family)
+		return err
+	}
+	return fmt.Errorf("metric %q produced no series", name)
+}
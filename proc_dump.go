@@ -0,0 +1,76 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/common/log"
+)
+
+// procDumpHandler returns the raw contents of a file below basePath, to help
+// diagnose parse problems without shell access to the node. Paths are given
+// relative to basePath and may not escape it.
+type procDumpHandler struct {
+	basePath string
+}
+
+func (h procDumpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	relPath := r.URL.Query().Get("path")
+	path, err := h.resolve(relPath)
+	if err != nil {
+		log.Warnf("Rejected proc dump request for %q from %s: %s", relPath, r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("couldn't read %s: %s", relPath, err), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(contents)
+}
+
+// resolve maps relPath onto a file below basePath, rejecting absolute paths,
+// '..' elements, and symlinks that lead outside basePath.
+func (h procDumpHandler) resolve(relPath string) (string, error) {
+	if relPath == "" {
+		return "", fmt.Errorf("missing 'path' parameter")
+	}
+	if filepath.IsAbs(relPath) {
+		return "", fmt.Errorf("path must be relative to %s", h.basePath)
+	}
+	for _, element := range strings.Split(relPath, "/") {
+		if element == ".." {
+			return "", fmt.Errorf("path may not contain '..'")
+		}
+	}
+	base, err := filepath.EvalSymlinks(h.basePath)
+	if err != nil {
+		return "", fmt.Errorf("couldn't resolve %s: %s", h.basePath, err)
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(base, relPath))
+	if err != nil {
+		return "", fmt.Errorf("couldn't resolve %s: %s", relPath, err)
+	}
+	if !strings.HasPrefix(path, base+string(filepath.Separator)) {
+		return "", fmt.Errorf("path resolves outside of %s", h.basePath)
+	}
+	return path, nil
+}
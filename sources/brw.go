@@ -0,0 +1,115 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// brwHistogram describes how a brw_stats block is exported as a histogram.
+// scale converts the row labels into the histogram's unit.
+type brwHistogram struct {
+	name     string
+	helpText string
+	scale    float64
+}
+
+// brwHistograms maps the brw_stats block names, as passed to the brw_stats
+// handler, to their histograms. Lustre reports no sum for these
+// distributions, so the histograms' sums are estimated by counting every
+// value of a bucket at its midpoint, between the previous bound (0 for the
+// first bucket) and its own.
+var brwHistograms = map[string]brwHistogram{
+	"pages_per_bulk_rw":   {name: "brw_pages_per_rpc", helpText: "Distribution of the number of pages per bulk RPC", scale: 1},
+	"discontiguous_pages": {name: "brw_discontiguous_pages", helpText: "Distribution of the number of logical discontinuities per bulk RPC", scale: 1},
+	"disk_IOs_in_flight":  {name: "brw_disk_ios_in_flight", helpText: "Distribution of the number of disk I/Os in flight when an I/O was started", scale: 1},
+	"IO_time":             {name: "brw_io_time_seconds", helpText: "Distribution of the time taken to complete bulk I/Os", scale: 0.001},
+	"disk_IO_size":        {name: "brw_disk_io_size_bytes", helpText: "Distribution of the size of disk I/Os", scale: 1},
+}
+
+// parseBRWBucket converts a brw_stats row label such as "256", "4K" or "1M"
+// into a number. Each row counts the values up to and including its label.
+func parseBRWBucket(label string) (bound float64, err error) {
+	multiplier := float64(1)
+	switch {
+	case strings.HasSuffix(label, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(label, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(label, "G"):
+		multiplier = 1 << 30
+	}
+	bound, err = strconv.ParseFloat(strings.TrimRight(label, "KMG"), 64)
+	if err != nil {
+		return 0, err
+	}
+	return bound * multiplier, nil
+}
+
+// brwBuckets collects the rows of each brw_stats block for one target.
+type brwBuckets map[string]map[string]map[float64]uint64
+
+func (b brwBuckets) add(name string, operation string, label string, value uint64) error {
+	if _, ok := brwHistograms[name]; !ok {
+		return nil
+	}
+	bound, err := parseBRWBucket(label)
+	if err != nil {
+		return err
+	}
+	if b[name] == nil {
+		b[name] = make(map[string]map[float64]uint64)
+	}
+	if b[name][operation] == nil {
+		b[name][operation] = make(map[float64]uint64)
+	}
+	b[name][operation][bound] += value
+	return nil
+}
+
+// histograms returns one histogram per block and operation.
+func (b brwBuckets) histograms(nodeType string, nodeName string) (metrics []prometheus.Metric) {
+	labels, labelValues := targetLabels(nodeType, nodeName)
+	for name, operations := range b {
+		histogram := brwHistograms[name]
+		desc := prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", histogram.name),
+			histogram.helpText+"; the sum is estimated from bucket midpoints",
+			append(labels, "operation"),
+			nil,
+		)
+		for operation, rows := range operations {
+			bounds := make([]float64, 0, len(rows))
+			for bound := range rows {
+				bounds = append(bounds, bound)
+			}
+			sort.Float64s(bounds)
+			buckets := make(map[float64]uint64, len(rows))
+			var count uint64
+			var sum, previous float64
+			for _, bound := range bounds {
+				count += rows[bound]
+				buckets[bound*histogram.scale] = count
+				sum += float64(rows[bound]) * (previous + bound) / 2 * histogram.scale
+				previous = bound
+			}
+			metrics = append(metrics, prometheus.MustNewConstHistogram(desc, count, sum, buckets, append(labelValues, operation)...))
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,80 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+var (
+	capacityCacheInterval = flag.Duration("capacity-cache-interval", 0, "How long to reuse capacity values (kbytes*, files*) before reading them again; 0 reads them on every scrape.")
+
+	// capacityMetrics change slowly enough to be served from the cache.
+	capacityMetrics = map[string]bool{
+		"filesfree":   true,
+		"filestotal":  true,
+		"kbytesavail": true,
+		"kbytesfree":  true,
+		"kbytestotal": true,
+	}
+)
+
+type cachedFile struct {
+	contents []byte
+	readAt   time.Time
+}
+
+// fileCache holds file contents for up to ttl before they are read again.
+type fileCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedFile
+}
+
+func newFileCache(ttl time.Duration) *fileCache {
+	return &fileCache{ttl: ttl, entries: make(map[string]cachedFile)}
+}
+
+// readFile returns the contents of path, reading it only if the cached copy
+// is older than the cache's ttl.
+func (c *fileCache) readFile(path string, now time.Time) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[path]; ok && now.Sub(entry.readAt) < c.ttl {
+		return entry.contents, nil
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		delete(c.entries, path)
+		return nil, err
+	}
+	c.entries[path] = cachedFile{contents: contents, readAt: now}
+	return contents, nil
+}
+
+// maxAge returns the age of the oldest value currently served from the cache.
+func (c *fileCache) maxAge(now time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var age time.Duration
+	for _, entry := range c.entries {
+		if entryAge := now.Sub(entry.readAt); entryAge > age {
+			age = entryAge
+		}
+	}
+	return age
+}
@@ -0,0 +1,73 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// capaSites names the columns of the capa_count file, which holds the number
+// of capabilities cached for clients and for servers.
+var capaSites = []string{"client", "server"}
+
+// capaMetrics exports the capability counts of every MDT with capabilities
+// enabled. Capabilities exist only in Lustre releases before 2.8, and
+// nothing is exported when they are disabled.
+func (s *lustreSource) capaMetrics(ch chan<- prometheus.Metric) error {
+	paths, err := filepath.Glob(filepath.Join(s.basePaths[procTree], "mdt/*/capa_count"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		mdt := filepath.Base(dir)
+		if !s.targets.allowed(mdt) {
+			continue
+		}
+		enabled, ok, err := s.readTargetValue(dir, "capa")
+		if err != nil {
+			return err
+		}
+		if !ok || enabled == 0 {
+			continue
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				continue
+			}
+			return err
+		}
+		fields := strings.Fields(string(contents))
+		if len(fields) < len(capaSites) {
+			return fmt.Errorf("expected %d values in %s, got %d", len(capaSites), path, len(fields))
+		}
+		labels, labelValues := serverTargetLabels(mdt)
+		for i, site := range capaSites {
+			value, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return err
+			}
+			ch <- s.gaugeMetric("mdt_capa_count", "Number of capabilities cached by the MDT", append(labels, "site"), float64(value), append(labelValues, site)...)
+		}
+	}
+	return nil
+}
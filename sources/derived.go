@@ -0,0 +1,174 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	spaceLowThreshold  = flag.Float64("space-low-threshold", 0.05, "Fraction of available OST space below which lustre_ost_space_low is set to 1.")
+	inodesLowThreshold = flag.Float64("inodes-low-threshold", 0.05, "Fraction of free inodes below which lustre_inodes_low is set to 1.")
+	fsThroughput       = flag.Bool("fs-throughput", false, "Also export read/write byte counters summed across all OSTs of each filesystem.")
+)
+
+// targetKey identifies a single target (OST, MDT, ...) of a given node type.
+type targetKey struct {
+	nodeType string
+	target   string
+}
+
+// targetValues records the single values read for each target during a
+// scrape so that derived metrics can be computed once every file is read.
+type targetValues map[targetKey]map[string]float64
+
+func (t targetValues) add(nodeType string, target string, name string, value float64) {
+	key := targetKey{nodeType: nodeType, target: target}
+	if t[key] == nil {
+		t[key] = make(map[string]float64)
+	}
+	t[key][name] = value
+}
+
+// ratio returns numerator/denominator for the given target. ok is false if
+// either value is missing or the denominator is zero.
+func (t targetValues) ratio(key targetKey, numerator string, denominator string) (ratio float64, ok bool) {
+	num, ok := t[key][numerator]
+	if !ok {
+		return 0, false
+	}
+	den, ok := t[key][denominator]
+	if !ok || den == 0 {
+		return 0, false
+	}
+	return num / den, true
+}
+
+func validateThreshold(name string, value float64) error {
+	if value < 0 || value > 1 {
+		return fmt.Errorf("%s must be between 0 and 1, got %f", name, value)
+	}
+	return nil
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// derivedMetrics computes metrics that combine several values read for the
+// same target during a scrape.
+func (s *lustreSource) derivedMetrics(values targetValues, ch chan<- prometheus.Metric) {
+	for key := range values {
+		labels, labelValues := targetLabels(key.nodeType, key.target)
+		if ratio, ok := values.ratio(key, "filesfree", "filestotal"); ok {
+			ch <- s.gaugeMetric("inodes_low", "Binary indicator as to whether the free inodes on the target are below the configured threshold - 0 for not low, 1 for low", labels, boolToFloat(ratio < *inodesLowThreshold), labelValues...)
+		}
+		total, hasTotal := values[key]["kbytestotal"]
+		free, hasFree := values[key]["kbytesfree"]
+		if hasTotal && hasFree && total >= free {
+			ch <- s.constMetric(key.nodeType, key.target, "kbytesused", "Number of kilobytes used in the pool", prometheus.GaugeValue, total-free)
+		}
+		if key.nodeType == "MDS" {
+			next, hasNext := values[key]["prealloc_next_id"]
+			last, hasLast := values[key]["prealloc_last_id"]
+			if hasNext && hasLast {
+				var remaining float64
+				if last > next {
+					remaining = last - next
+				}
+				ch <- s.gaugeMetric("osp_precreate_remaining", "Number of precreated objects remaining before the MDS must wait for the OST to create more", labels, remaining, labelValues...)
+			}
+		}
+		if key.nodeType != "OSS" {
+			continue
+		}
+		if ratio, ok := values.ratio(key, "kbytesavail", "kbytestotal"); ok {
+			ch <- s.gaugeMetric("ost_space_low", "Binary indicator as to whether the available space on the OST is below the configured threshold - 0 for not low, 1 for low", labels, boolToFloat(ratio < *spaceLowThreshold), labelValues...)
+		}
+		// The available space reported by the OST already excludes the space
+		// granted to clients, so the two together make up the grantable space.
+		granted, hasGranted := values[key]["tot_granted"]
+		avail, hasAvail := values[key]["kbytesavail"]
+		if hasGranted && hasAvail && granted+avail*1024 > 0 {
+			ch <- s.gaugeMetric("ost_grant_used_ratio", "Fraction of the grantable space on the OST that is currently granted to clients", labels, granted/(granted+avail*1024), labelValues...)
+		}
+	}
+	if *fsThroughput {
+		s.filesystemThroughput(values, ch)
+	}
+	ch <- s.gaugeMetric("ost_space_low_threshold_ratio", "Fraction of available OST space below which lustre_ost_space_low is set", nil, *spaceLowThreshold)
+	ch <- s.gaugeMetric("inodes_low_threshold_ratio", "Fraction of free inodes below which lustre_inodes_low is set", nil, *inodesLowThreshold)
+}
+
+func (s *lustreSource) gaugeMetric(name string, helpText string, labels []string, value float64, labelValues ...string) prometheus.Metric {
+	return prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", name),
+			helpText,
+			labels,
+			nil,
+		),
+		prometheus.GaugeValue,
+		value,
+		labelValues...,
+	)
+}
+
+// filesystemThroughput sums the read and write byte counters of every OST
+// belonging to the same filesystem.
+func (s *lustreSource) filesystemThroughput(values targetValues, ch chan<- prometheus.Metric) {
+	readBytes := make(map[string]float64)
+	writeBytes := make(map[string]float64)
+	for key, targetStats := range values {
+		if key.nodeType != "OSS" {
+			continue
+		}
+		target, ok := parseTargetName(key.target)
+		if !ok {
+			continue
+		}
+		if value, ok := targetStats["read_total_bytes"]; ok {
+			readBytes[target.fsName] += value
+		}
+		if value, ok := targetStats["write_total_bytes"]; ok {
+			writeBytes[target.fsName] += value
+		}
+	}
+	for fsName, value := range readBytes {
+		ch <- s.counterMetric("fs_read_bytes_total", "Total number of bytes read from all OSTs of the filesystem", []string{"fs_name"}, value, fsName)
+	}
+	for fsName, value := range writeBytes {
+		ch <- s.counterMetric("fs_write_bytes_total", "Total number of bytes written to all OSTs of the filesystem", []string{"fs_name"}, value, fsName)
+	}
+}
+
+func (s *lustreSource) counterMetric(name string, helpText string, labels []string, value float64, labelValues ...string) prometheus.Metric {
+	return prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", name),
+			helpText,
+			labels,
+			nil,
+		),
+		prometheus.CounterValue,
+		value,
+		labelValues...,
+	)
+}
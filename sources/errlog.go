@@ -0,0 +1,130 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	errorLogMinInterval = time.Minute
+	errorLogMaxInterval = time.Hour
+)
+
+type errorLogEntry struct {
+	next       time.Time
+	interval   time.Duration
+	suppressed int
+}
+
+// errorLogLimiter rate-limits logging of repeated identical errors. After an
+// error is logged, the same error is suppressed for an interval that doubles
+// each time it recurs, up to errorLogMaxInterval.
+type errorLogLimiter struct {
+	mu      sync.Mutex
+	entries map[string]*errorLogEntry
+}
+
+func newErrorLogLimiter() *errorLogLimiter {
+	return &errorLogLimiter{entries: make(map[string]*errorLogEntry)}
+}
+
+// shouldLog reports whether the error identified by key should be logged now,
+// and how many occurrences were suppressed since it was last logged.
+func (l *errorLogLimiter) shouldLog(key string, now time.Time) (ok bool, suppressed int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, found := l.entries[key]
+	if !found {
+		l.entries[key] = &errorLogEntry{next: now.Add(errorLogMinInterval), interval: errorLogMinInterval}
+		return true, 0
+	}
+	if now.Before(entry.next) {
+		entry.suppressed++
+		return false, entry.suppressed
+	}
+	suppressed = entry.suppressed
+	entry.interval *= 2
+	if entry.interval > errorLogMaxInterval {
+		entry.interval = errorLogMaxInterval
+	}
+	entry.next = now.Add(entry.interval)
+	entry.suppressed = 0
+	return true, suppressed
+}
+
+// maxCollectErrors bounds the number of distinct errors kept for
+// CollectErrors; the least recently seen error is dropped first.
+const maxCollectErrors = 100
+
+// CollectError describes a recent failure to read or parse a file.
+type CollectError struct {
+	Path     string    `json:"path"`
+	Message  string    `json:"message"`
+	Count    int       `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// errorTracker keeps the most recent collection errors, keyed by path.
+type errorTracker struct {
+	mu     sync.Mutex
+	errors map[string]*CollectError
+}
+
+var collectErrors = &errorTracker{errors: make(map[string]*CollectError)}
+
+func (t *errorTracker) record(path string, err error, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, found := t.errors[path]
+	if !found {
+		if len(t.errors) >= maxCollectErrors {
+			t.evictOldest()
+		}
+		entry = &CollectError{Path: path}
+		t.errors[path] = entry
+	}
+	entry.Message = err.Error()
+	entry.Count++
+	entry.LastSeen = now
+}
+
+func (t *errorTracker) evictOldest() {
+	var oldest *CollectError
+	for _, entry := range t.errors {
+		if oldest == nil || entry.LastSeen.Before(oldest.LastSeen) {
+			oldest = entry
+		}
+	}
+	if oldest != nil {
+		delete(t.errors, oldest.Path)
+	}
+}
+
+// CollectErrors returns the most recent read and parse errors, most recently
+// seen first.
+func CollectErrors() []CollectError {
+	collectErrors.mu.Lock()
+	defer collectErrors.mu.Unlock()
+	errors := make([]CollectError, 0, len(collectErrors.errors))
+	for _, entry := range collectErrors.errors {
+		errors = append(errors, *entry)
+	}
+	sort.Slice(errors, func(i, j int) bool {
+		return errors[i].LastSeen.After(errors[j].LastSeen)
+	})
+	return errors
+}
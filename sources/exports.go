@@ -0,0 +1,152 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	exportsEnabled = flag.Bool("collector.exports", false, "Collect per-client (export) metrics from the exports directory of each target. Produces one series per client NID.")
+
+	// exportPaths lists the per-target exports directories, holding one
+	// directory per connected client NID.
+	exportPaths = []string{
+		"obdfilter/*/exports/*",
+		"mdt/*/exports/*",
+	}
+)
+
+// exportDir is the exports directory of a single client on a single target.
+type exportDir struct {
+	path   string
+	target string
+	nid    string
+}
+
+// exportDirs returns every per-client exports directory in the proc tree.
+// The 'clear' entry used to reset export stats is skipped.
+func (s *lustreSource) exportDirs() (exports []exportDir, err error) {
+	for _, pattern := range exportPaths {
+		paths, err := filepath.Glob(filepath.Join(s.basePaths[procTree], pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			target := filepath.Base(filepath.Dir(filepath.Dir(path)))
+			if filepath.Base(path) == "clear" || !s.targets.allowed(target) {
+				continue
+			}
+			exports = append(exports, exportDir{
+				path:   path,
+				target: target,
+				nid:    filepath.Base(path),
+			})
+		}
+	}
+	return exports, nil
+}
+
+// exportMetrics exports per-client metrics for every target when the exports
+// collector is enabled.
+func (s *lustreSource) exportMetrics(now time.Time, ch chan<- prometheus.Metric) error {
+	if !*exportsEnabled {
+		return nil
+	}
+	exports, err := s.exportDirs()
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		labels, labelValues := serverTargetLabels(export.target)
+		labels, labelValues = append(labels, "nid"), append(labelValues, export.nid)
+		locks, ok, err := exportHeldLocks(export.path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			ch <- s.gaugeMetric("export_held_locks", "Upper-bound estimate of the number of locks the client holds on the target, computed as lock enqueues minus cancels; locks released without a cancel are still counted", labels, float64(locks), labelValues...)
+		}
+		lastActive, ok, err := exportLastActivity(export.path)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		ch <- s.gaugeMetric("export_last_activity_timestamp_seconds", "Time of the last request from the client to the target, in seconds since the epoch", labels, float64(lastActive), labelValues...)
+		ch <- s.gaugeMetric("export_seconds_since_last_activity", "Seconds since the last request from the client to the target", labels, now.Sub(time.Unix(lastActive, 0)).Seconds(), labelValues...)
+	}
+	return nil
+}
+
+// exportLastActivity reads the last request time of a client from the
+// 'export' file of its exports directory. ok is false for Lustre releases
+// that don't report it.
+func exportLastActivity(path string) (lastActive int64, ok bool, err error) {
+	contents, err := ioutil.ReadFile(filepath.Join(path, "export"))
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	raw, ok := parseKeyValueFile(string(contents))["last_active"]
+	if !ok {
+		return 0, false, nil
+	}
+	lastActive, err = strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return lastActive, true, nil
+}
+
+// exportHeldLocks estimates the locks held by a client from the ldlm_stats
+// file of its exports directory. Every lock is enqueued once, but not every
+// release is counted as a cancel, so the difference is an upper bound on the
+// number of locks still held.
+func exportHeldLocks(path string) (locks uint64, ok bool, err error) {
+	contents, err := ioutil.ReadFile(filepath.Join(path, "ldlm_stats"))
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	samples := make(map[string]uint64)
+	for _, entry := range parseStatsEntries(string(contents)) {
+		value, err := strconv.ParseUint(entry.fields[1], 10, 64)
+		if err != nil {
+			return 0, false, err
+		}
+		samples[entry.name] = value
+	}
+	enqueued, ok := samples["ldlm_enqueue"]
+	if !ok {
+		return 0, false, nil
+	}
+	cancelled := samples["ldlm_cancel"]
+	if cancelled > enqueued {
+		return 0, true, nil
+	}
+	return enqueued - cancelled, true, nil
+}
@@ -0,0 +1,407 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// combinedFixture is a node running an OSS, an MDS, an MGS and a client mount
+// at once, keyed by path relative to the fixture root.
+var combinedFixture = map[string]string{
+	"aliases": `# aliases
+lustrefs-OST0000 scratch-ost0
+`,
+	"proc/devices": `  0 UP osd-ldiskfs lustrefs-OST0000-osd lustrefs-OST0000-osd_UUID 4
+  1 UP obdfilter lustrefs-OST0000 lustrefs-OST0000_UUID 5
+  2 ST mdt lustrefs-MDT0000 lustrefs-MDT0000_UUID 3
+`,
+	"proc/llite/lustrefs-ffff88/blocksize": `4096
+`,
+	"proc/llite/lustrefs-ffff88/filesfree": `50
+`,
+	"proc/llite/lustrefs-ffff88/filestotal": `100
+`,
+	"proc/llite/lustrefs-ffff88/kbytesavail": `350
+`,
+	"proc/llite/lustrefs-ffff88/kbytesfree": `400
+`,
+	"proc/llite/lustrefs-ffff88/kbytestotal": `1000
+`,
+	"proc/llite/lustrefs-ffff88/statfs_max_age": `1
+`,
+	"proc/llite/lustrefs-ffff88/stats": `snapshot_time             1499896316.294447271 secs.usecs
+read_bytes                4 samples [bytes] 0 4096 8192
+write_bytes               2 samples [bytes] 512 1024 1536
+open                      10 samples [regs]
+close                     10 samples [regs]
+fsync                     1 samples [regs]
+`,
+	"proc/lod/lustrefs-MDT0000-mdtlov/qos_maxage": "5 Sec\n",
+	"proc/lod/lustrefs-MDT0000-mdtlov/target_obd": `0: lustrefs-OST0000_UUID ACTIVE
+1: lustrefs-OST0001_UUID INACTIVE
+`,
+	"proc/mdd/lustrefs-MDT0000/lfsck_layout": `name: lfsck_layout
+magic: 0xb1734d76
+version: 2
+status: completed
+`,
+	"proc/mds/MDS/mdt/timeouts": `service : cur  33  worst  34 (at 1193427052, 0d0h26m40s ago)   1  1  33  2
+`,
+	"proc/mds/MDS/mdt_readpage/stats": `snapshot_time 1.5 secs.usecs
+close 3 samples [usec] 1 9 12
+`,
+	"proc/mds/MDS/osd/blocksize": `4096
+`,
+	"proc/mds/MDS/osd/filesfree": `1000
+`,
+	"proc/mds/MDS/osd/filestotal": `2000
+`,
+	"proc/mds/MDS/osd/kbytesavail": `100
+`,
+	"proc/mds/MDS/osd/kbytesfree": `120
+`,
+	"proc/mds/MDS/osd/kbytestotal": `200
+`,
+	"proc/mdt/lustrefs-MDT0000/capa": `1
+`,
+	"proc/mdt/lustrefs-MDT0000/capa_count": `3 5
+`,
+	"proc/mdt/lustrefs-MDT0000/degraded": `0
+`,
+	"proc/mdt/lustrefs-MDT0000/identity_expire": `600
+`,
+	"proc/mdt/lustrefs-MDT0000/job_stats": `job_stats:
+- job_id:          bash.0
+  snapshot_time:   1409777887
+  open:            { samples:           2, unit:  usecs, min: 23, max: 30, sum: 53, sumsq: 1429 }
+  close:           { samples:           0, unit:  usecs, min: 0, max: 0, sum: 0, sumsq: 0 }
+  getattr:         { samples:           3, unit:  reqs }
+- job_id:          dd.1
+  snapshot_time:   1409777887
+  open:            { samples:           1, unit:  usecs, min: 10, max: 10, sum: 10, sumsq: 100 }
+`,
+	"proc/mdt/lustrefs-MDT0000/md_stats": `snapshot_time 1.5 secs.usecs
+open 5 samples [reqs]
+close 5 samples [reqs]
+getattr 12 samples [usecs] 3 40 120 2000
+migrate 2 samples [reqs]
+`,
+	"proc/mdt/lustrefs-MDT0000/nosquash_nids": `NONE
+`,
+	"proc/mdt/lustrefs-MDT0000/open_files_in_use": `17
+`,
+	"proc/mdt/lustrefs-MDT0000/recovery_status": `status: COMPLETE
+`,
+	"proc/mdt/lustrefs-MDT0000/uuid": `lustrefs-MDT0000_UUID
+`,
+	"proc/mgc/MGC10.0.0.1@tcp/import": `import:
+    name: MGC10.0.0.1@tcp
+    target: MGS
+    state: FULL
+    connection:
+       failover_nids: [ 10.0.0.1@tcp ]
+       current_connection: 10.0.0.1@tcp
+       connection_attempts: 4
+    rpcs:
+       inflight: 0
+       timeouts: 2
+`,
+	"proc/mgs/MGS/live/lustrefs": ``,
+	"proc/mgs/MGS/live/params":   ``,
+	"proc/mgs/MGS/osd/blocksize": `4096
+`,
+	"proc/mgs/MGS/osd/filesfree": `1000
+`,
+	"proc/mgs/MGS/osd/filestotal": `2000
+`,
+	"proc/mgs/MGS/osd/kbytesavail": `100
+`,
+	"proc/mgs/MGS/osd/kbytesfree": `120
+`,
+	"proc/mgs/MGS/osd/kbytestotal": `200
+`,
+	"proc/obdfilter/lustrefs-OST0000/brw_stats": `snapshot_time:         1409777887.590578 (secs.usecs)
+
+                           read      |     write
+pages per bulk r/w     rpcs  % cum % |  rpcs        % cum %
+1:                       5  50  50   |    2  20  20
+256:                     5  50 100   |    8  80 100
+
+                           read      |     write
+discontiguous pages    rpcs  % cum % |  rpcs        % cum %
+0:                      10 100 100   |   10 100 100
+
+                           read      |     write
+I/O time (1/1000s)     ios   % cum % |  ios         % cum %
+1:                       3  30  30   |    5  50  50
+4:                       7  70 100   |    5  50 100
+
+                           read      |     write
+disk I/O size          ios   % cum % |  ios         % cum %
+4K:                      4  40  40   |    0   0   0
+1M:                      6  60 100   |   10 100 100
+`,
+	"proc/obdfilter/lustrefs-OST0000/degraded": `0
+`,
+	"proc/obdfilter/lustrefs-OST0000/exports/10.0.0.1@tcp/export": `abc-uuid:
+    name: lustrefs-OST0000
+    client: 10.0.0.1@tcp
+    last_active: 1700000000
+`,
+	"proc/obdfilter/lustrefs-OST0000/exports/10.0.0.1@tcp/ldlm_stats": `snapshot_time             1409777887.590578 secs.usecs
+ldlm_enqueue              10 samples [reqs]
+ldlm_cancel               4 samples [reqs]
+`,
+	"proc/obdfilter/lustrefs-OST0000/exports/clear": ``,
+	"proc/obdfilter/lustrefs-OST0000/filesfree": `5
+`,
+	"proc/obdfilter/lustrefs-OST0000/filestotal": `1000
+`,
+	"proc/obdfilter/lustrefs-OST0000/job_stats": `job_stats:
+- job_id:          "slurm.1234"
+  snapshot_time:   1499896316
+  read_bytes:      { samples:           2, unit: bytes, min:    4096, max: 1048576, sum:         1052672, hist: { 4K: 1, 1M: 1 } }
+  write_bytes:     { samples:           0, unit: bytes, min:       0, max:       0, sum:               0 }
+  punch:           { samples:           1, unit:  usecs, min:      12, max:      12, sum:              12 }
+- job_id:          dd.0
+  read_bytes:      { samples:           1, unit: bytes, min:    4096, max:    4096, sum:            4096 }
+`,
+	"proc/obdfilter/lustrefs-OST0000/kbytesavail": `100
+`,
+	"proc/obdfilter/lustrefs-OST0000/kbytesfree": `9000
+`,
+	"proc/obdfilter/lustrefs-OST0000/kbytestotal": `10000
+`,
+	"proc/obdfilter/lustrefs-OST0000/lfsck_layout": `name: lfsck_layout
+magic: 0xb1734d76
+version: 2
+status: completed
+`,
+	"proc/obdfilter/lustrefs-OST0000/num_exports": `5
+`,
+	"proc/obdfilter/lustrefs-OST0000/recovery_status": `status: RECOVERING
+recovery_start: 1409777887
+time_remaining: 120
+connected_clients: 2/3
+`,
+	"proc/obdfilter/lustrefs-OST0000/stats": `snapshot_time	1.0 secs.usecs
+read_bytes	4	samples	[bytes]	1	2	5
+write_bytes 2 samples [bytes] 8 8 16
+read 4 samples [usec] 10 20 50
+set_info  3 samples [reqs]
+punch 1 samples [reqs]
+`,
+	"proc/obdfilter/lustrefs-OST0000/sync_journal": `disabled
+`,
+	"proc/obdfilter/lustrefs-OST0000/tot_granted": `1048576
+`,
+	"proc/obdfilter/lustrefs-OST0000/uuid": `lustrefs-OST0000_UUID
+`,
+	"proc/osc/lustrefs-OST0000-osc-ffff88/destroys_in_flight": `3
+`,
+	"proc/osc/lustrefs-OST0000-osc-ffff88/import": `import:
+    name: lustrefs-OST0000-osc-ffff88
+    target: lustrefs-OST0000_UUID
+    state: FULL
+    connect_flags: [ write_grant, server_lock ]
+    import_flags: [ replayable, pingable ]
+    connection:
+       failover_nids: [ 10.0.0.1@tcp, 10.0.0.2@tcp ]
+       current_connection: 10.0.0.1@tcp
+       connection_attempts: 3
+       generation: 1
+       in-progress_invalidations: 0
+       idle: 7 sec
+    rpcs:
+       inflight: 0
+       unregistering: 0
+       timeouts: 0
+       avg_waittime: 1000 usec
+    service_estimates:
+       services: 1 sec
+       network: 1 sec
+    transactions:
+       last_replay: 0
+       peer_committed: 12884901890
+       last_checked: 12884901890
+`,
+	"proc/osc/lustrefs-OST0000-osc-ffff88/max_pages_per_rpc": `1024
+`,
+	"proc/osc/lustrefs-OST0000-osc-ffff88/rpc_stats": `snapshot_time:         1409777887.590578 (secs.usecs)
+read RPCs in flight:  2
+write RPCs in flight: 8
+pending write pages:  0
+
+                        read                    write
+pages per rpc         rpcs   % cum % |       rpcs   % cum %
+1:                       0   0   0   |          0   0   0
+`,
+	"proc/osc/lustrefs-OST0000-osc-ffff88/stats": `snapshot_time 1.0 secs.usecs
+req_waittime 100 samples [usec] 10 300 5000 400000
+ost_destroy 7 samples [usec] 5 20 70 900
+ost_punch 3 samples [usec] 5 20 30 900
+ost_setattr 2 samples [usec] 5 20 30 900
+`,
+	"proc/osd-ldiskfs/lustrefs-MDT0000/stats": `snapshot_time 1.5 secs.usecs
+get_page 4 samples [usec] 1 9 20
+`,
+	"proc/osd-ldiskfs/lustrefs-OST0000/stats": `snapshot_time 1.5 secs.usecs
+get_page 7 samples [usec] 1 9 30
+`,
+	"proc/osd-zfs/lustrefs-OST0000/filesfree": `40
+`,
+	"proc/osd-zfs/lustrefs-OST0000/filestotal": `100
+`,
+	"proc/osd-zfs/lustrefs-OST0000/quota_slave/acct_project": `prj_accounting:
+- id:      0
+  usage:   { inodes:                  209, kbytes:             2616 }
+- id:      1500
+  usage:   { inodes:                    1, kbytes:                4 }
+`,
+	"proc/osp/lustrefs-OST0000-osc-MDT0000/prealloc_last_id": `100
+`,
+	"proc/osp/lustrefs-OST0000-osc-MDT0000/prealloc_next_id": `90
+`,
+	"proc/ost/OSS/ost_io/timeouts": `service : cur  33  worst  34 (at 1193427052, 0d0h26m40s ago)   1  1  33  2
+`,
+	"slabinfo": `slabinfo - version: 2.1
+# name            <active_objs> <num_objs> <objsize> <objperslab> <pagesperslab> : tunables <limit> <batchcount> <sharedfactor> : slabdata <active_slabs> <num_slabs> <sharedavail>
+ldlm_locks  100 120 512 8 1 : tunables 0 0 0 : slabdata 15 15 0
+kmalloc-8 1 1 8 1 1 : tunables 0 0 0 : slabdata 1 1 0
+`,
+	"sys/ldlm/namespaces/mdt-lustrefs-MDT0000_UUID/lock_count": `42
+`,
+	"sys/ldlm/namespaces/mdt-lustrefs-MDT0000_UUID/lock_timeouts": `3
+`,
+	"sys/llite/lustrefs-ffff88/max_read_ahead_mb": `64
+`,
+	"sys/timeout": `100
+`,
+}
+
+// writeFixture creates the files of a fixture below root.
+func writeFixture(t testing.TB, root string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// useFixturePaths points the path flags at the proc and sys trees below root
+// until the test finishes.
+func useFixturePaths(t testing.TB, root string) {
+	saved := []struct {
+		flag  *string
+		value string
+	}{
+		{hostProcfsPath, root},
+		{procfsPath, filepath.Join(root, "proc")},
+		{sysfsPath, filepath.Join(root, "sys")},
+		{slabinfoPath, ""},
+	}
+	for i := range saved {
+		saved[i].value, *saved[i].flag = *saved[i].flag, saved[i].value
+	}
+	t.Cleanup(func() {
+		for _, s := range saved {
+			*s.flag = s.value
+		}
+	})
+}
+
+// setBoolFlag sets a boolean flag until the test finishes.
+func setBoolFlag(t testing.TB, flag *bool, value bool) {
+	saved := *flag
+	*flag = value
+	t.Cleanup(func() { *flag = saved })
+}
+
+// sourceCollector exposes a source to a registry so tests can check the
+// metrics it produces with Gather.
+type sourceCollector struct {
+	t      testing.TB
+	source LustreSource
+}
+
+func (c sourceCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c sourceCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.source.Update(context.Background(), ch); err != nil {
+		c.t.Errorf("Update failed: %s", err)
+	}
+}
+
+// newFixtureSource creates a procfs source reading the fixture tree below
+// root and a registry gathering from it.
+func newFixtureSource(t testing.TB, root string) (LustreSource, *prometheus.Registry) {
+	useFixturePaths(t, root)
+	source, err := NewLustreSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(sourceCollector{t: t, source: source}); err != nil {
+		t.Fatal(err)
+	}
+	return source, registry
+}
+
+// gatherValue returns the value of the series with the given name and labels
+// gathered from registry, or the sum of a histogram, and whether it was
+// found.
+func gatherValue(t testing.TB, registry *prometheus.Registry, name string, labels map[string]string) (float64, bool) {
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %s", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	series:
+		for _, metric := range family.GetMetric() {
+			if len(metric.GetLabel()) != len(labels) {
+				continue
+			}
+			for _, label := range metric.GetLabel() {
+				if value, ok := labels[label.GetName()]; !ok || value != label.GetValue() {
+					continue series
+				}
+			}
+			switch {
+			case metric.Counter != nil:
+				return metric.GetCounter().GetValue(), true
+			case metric.Gauge != nil:
+				return metric.GetGauge().GetValue(), true
+			case metric.Untyped != nil:
+				return metric.GetUntyped().GetValue(), true
+			case metric.Histogram != nil:
+				return metric.GetHistogram().GetSampleSum(), true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,127 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	collectorMaxFailures     = flag.Int("collector.max-failures", 5, "Disable an optional collector after this many consecutive failures or panics; 0 never disables collectors.")
+	collectorDisableCooldown = flag.Duration("collector.disable-cooldown", 10*time.Minute, "How long an optional collector stays disabled after --collector.max-failures consecutive failures.")
+)
+
+var collectorErrors = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "exporter",
+		Name:      "collector_errors_total",
+		Help:      "Total number of times an optional collector failed or panicked.",
+	},
+	[]string{"collector"},
+)
+
+func init() {
+	prometheus.MustRegister(collectorErrors)
+}
+
+type guardState struct {
+	failures      int
+	disabledUntil time.Time
+}
+
+// collectorGuard isolates optional collectors from the rest of a scrape: a
+// panic is turned into an error, and a collector that keeps failing is
+// skipped until --collector.disable-cooldown has passed. Core collectors
+// such as capacity and target health are never run through it.
+type collectorGuard struct {
+	mu     sync.Mutex
+	states map[string]*guardState
+}
+
+func newCollectorGuard() *collectorGuard {
+	return &collectorGuard{states: make(map[string]*guardState)}
+}
+
+// run calls collect unless the named collector is disabled, and records
+// whether it succeeded.
+func (g *collectorGuard) run(collector string, now time.Time, ch chan<- prometheus.Metric, collect func(chan<- prometheus.Metric) error) (err error) {
+	g.mu.Lock()
+	state, found := g.states[collector]
+	if !found {
+		state = &guardState{}
+		g.states[collector] = state
+	}
+	disabled := now.Before(state.disabledUntil)
+	g.mu.Unlock()
+	if disabled {
+		return nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("collector %q panicked: %v", collector, r)
+		}
+		g.record(collector, err == nil, now)
+	}()
+	return collect(ch)
+}
+
+func (g *collectorGuard) record(collector string, ok bool, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	state := g.states[collector]
+	if ok {
+		state.failures = 0
+		return
+	}
+	state.failures++
+	if *collectorMaxFailures > 0 && state.failures >= *collectorMaxFailures {
+		log.Warnf("Disabling collector %q for %s after %d consecutive failures", collector, *collectorDisableCooldown, state.failures)
+		state.failures = 0
+		state.disabledUntil = now.Add(*collectorDisableCooldown)
+	}
+}
+
+// disabled reports for every collector run so far whether it is currently
+// disabled.
+func (g *collectorGuard) disabled(now time.Time) map[string]bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	disabled := make(map[string]bool)
+	for collector, state := range g.states {
+		disabled[collector] = now.Before(state.disabledUntil)
+	}
+	return disabled
+}
+
+// retain forgets the collectors whose name starts with prefix but is not in
+// keep, such as the job_stats of targets that went away, so they are no
+// longer reported as disabled or running.
+func (g *collectorGuard) retain(prefix string, keep map[string]bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for collector := range g.states {
+		if strings.HasPrefix(collector, prefix) && !keep[collector] {
+			delete(g.states, collector)
+		}
+	}
+}
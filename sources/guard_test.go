@@ -0,0 +1,42 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollectorGuardRetain(t *testing.T) {
+	guard := newCollectorGuard()
+	now := time.Unix(100, 0)
+	fail := func(chan<- prometheus.Metric) error { return errors.New("failed") }
+	for _, collector := range []string{"job_stats:lustrefs-OST0000", "job_stats:lustrefs-OST0001", "quota"} {
+		guard.run(collector, now, nil, fail)
+	}
+
+	guard.retain("job_stats:", map[string]bool{"job_stats:lustrefs-OST0000": true})
+	disabled := guard.disabled(now)
+	for _, collector := range []string{"job_stats:lustrefs-OST0000", "quota"} {
+		if _, ok := disabled[collector]; !ok {
+			t.Errorf("%s was forgotten", collector)
+		}
+	}
+	if _, ok := disabled["job_stats:lustrefs-OST0001"]; ok {
+		t.Error("job_stats:lustrefs-OST0001 was not forgotten")
+	}
+}
@@ -0,0 +1,108 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	targetStaleAfter = flag.Duration("target-stale-after", 5*time.Minute, "Time after which a target whose stats counted no new requests is reported as down by lustre_target_up.")
+
+	// targetStatsFiles maps the device types listed in the devices file to
+	// the stats file whose sample counts show the target is still handling
+	// requests.
+	targetStatsFiles = map[string]string{
+		"obdfilter": "obdfilter/%s/stats",
+		"mdt":       "mdt/%s/md_stats",
+	}
+)
+
+// lustreDevice is a single line of the Lustre devices file, e.g.
+// "  3 UP obdfilter lustrefs-OST0000 lustrefs-OST0000_UUID 5".
+type lustreDevice struct {
+	status     string
+	deviceType string
+	name       string
+}
+
+func parseDevices(contents string) (devices []lustreDevice) {
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		devices = append(devices, lustreDevice{status: fields[1], deviceType: fields[2], name: fields[3]})
+	}
+	return devices
+}
+
+// statsActivity returns the total number of samples counted by a stats
+// file. Unlike snapshot_time, which is the time the file was read and so
+// advances on every read, it only moves when the target handles requests.
+func statsActivity(statsFile string) (total float64, err error) {
+	for _, entry := range parseStatsEntries(statsFile) {
+		samples, err := strconv.ParseUint(entry.fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		total += float64(samples)
+	}
+	return total, nil
+}
+
+// statsAdvancing reports whether the stats file at statsPath counted new
+// requests within --target-stale-after.
+func (s *lustreSource) statsAdvancing(target string, statsPath string, now time.Time) bool {
+	stats, err := ioutil.ReadFile(filepath.Join(s.basePaths[procTree], statsPath))
+	if err != nil {
+		return false
+	}
+	activity, err := statsActivity(string(stats))
+	if err != nil {
+		return false
+	}
+	return s.staleness.stale(target, activity, now) <= *targetStaleAfter
+}
+
+// targetHealth exports lustre_target_up for every OST and MDT in the devices
+// file: 1 if the device is UP and its stats are still advancing, 0 otherwise.
+func (s *lustreSource) targetHealth(now time.Time, ch chan<- prometheus.Metric) error {
+	contents, err := ioutil.ReadFile(filepath.Join(s.basePaths[procTree], "devices"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, device := range parseDevices(string(contents)) {
+		statsPath, ok := targetStatsFiles[device.deviceType]
+		if !ok || !s.targets.allowed(device.name) {
+			continue
+		}
+		up := device.status == "UP" && s.statsAdvancing(device.name, fmt.Sprintf(statsPath, device.name), now)
+		labels, labelValues := serverTargetLabels(device.name)
+		ch <- s.gaugeMetric("target_up", "Whether the target device is UP and its stats are advancing (1) or not (0)", labels, boolToFloat(up), labelValues...)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// importTransactionFields lists the transaction numbers of an import, exported
+// so the commit lag between a client or MDT and its target can be computed.
+var importTransactionFields = map[string]string{
+	"last_replay":    "Transaction number of the last request replayed by the import during recovery",
+	"peer_committed": "Last transaction number the target reported as committed to disk",
+	"last_checked":   "Last committed transaction number processed by the import",
+}
+
+// importComponents lists the devices with an 'import' file describing their
+// connection to a target: osc and mdc on clients, osp and lwp on servers, and
+// mgc for the config log connection to the MGS on every node.
+var importComponents = []string{"osc", "mdc", "osp", "lwp", "mgc"}
+
+// parseImportFile flattens the YAML-like 'import' file into a map keyed by
+// section and field, e.g. "connection.current_connection". Top-level fields
+// of the import section, such as "state", keep their plain name.
+func parseImportFile(contents string) map[string]string {
+	values := make(map[string]string)
+	section := ""
+	for _, line := range strings.Split(contents, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		switch {
+		case indent == 0:
+			continue
+		case indent <= 4 && value == "":
+			section = key
+		case indent <= 4:
+			section = ""
+			values[key] = value
+		case section != "":
+			values[section+"."+key] = value
+		}
+	}
+	return values
+}
+
+// pingInterval returns the interval at which imports ping their targets,
+// which Lustre derives from the obd timeout as max(timeout/4, 1) seconds.
+// ok is false if the timeout can't be read.
+func (s *lustreSource) pingInterval() (interval uint64, ok bool) {
+	contents, err := ioutil.ReadFile(filepath.Join(s.basePaths[sysfsTree], "timeout"))
+	if err != nil {
+		return 0, false
+	}
+	timeout, skip, err := parseSingleValue(string(contents))
+	if err != nil || skip {
+		return 0, false
+	}
+	if timeout < 4 {
+		return 1, true
+	}
+	return timeout / 4, true
+}
+
+// parseSeconds parses values such as "12 sec" from an 'import' file.
+func parseSeconds(value string) (seconds uint64, err error) {
+	return strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(value, "sec")), 10, 64)
+}
+
+// listElements returns the sorted elements of an inline list such as
+// "[ write_grant, server_lock ]".
+func listElements(value string) []string {
+	value = strings.TrimSpace(strings.Trim(value, "[]"))
+	if value == "" {
+		return nil
+	}
+	elements := strings.Split(value, ",")
+	for i := range elements {
+		elements[i] = strings.TrimSpace(elements[i])
+	}
+	sort.Strings(elements)
+	return elements
+}
+
+// importMetrics exports the connection state of every import.
+func (s *lustreSource) importMetrics(ch chan<- prometheus.Metric) error {
+	interval, hasInterval := s.pingInterval()
+	for _, component := range importComponents {
+		paths, err := filepath.Glob(filepath.Join(s.basePaths[procTree], component, "*", "import"))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			target := filepath.Base(filepath.Dir(path))
+			if !s.targets.allowed(target) {
+				continue
+			}
+			contents, err := ioutil.ReadFile(path)
+			if err != nil {
+				if os.IsNotExist(err) || os.IsPermission(err) {
+					continue
+				}
+				return err
+			}
+			values := parseImportFile(string(contents))
+			// Import devices are labeled like the osc metrics of the same
+			// device, with the kind of import in 'component'.
+			labels, labelValues := targetLabels("target", target)
+			labels, labelValues = append(labels, "component"), append(labelValues, component)
+			if nids, ok := values["connection.failover_nids"]; ok {
+				ch <- s.gaugeMetric("import_available_connections", "Number of NIDs the import can connect to the target through, including failover NIDs", labels, float64(len(listElements(nids))), labelValues...)
+			}
+			if current, ok := values["connection.current_connection"]; ok {
+				active := current != "" && current != "<none>"
+				ch <- s.gaugeMetric("import_active_connections", "Number of connections the import currently has established to the target", labels, boolToFloat(active), labelValues...)
+			}
+			if attempts, ok := values["connection.connection_attempts"]; ok {
+				value, err := strconv.ParseUint(attempts, 10, 64)
+				if err != nil {
+					return err
+				}
+				ch <- s.counterMetric("import_connection_attempts_total", "Number of attempts made by the import to connect to the target", labels, float64(value), labelValues...)
+			}
+			if flags, ok := values["connect_flags"]; ok {
+				ch <- s.gaugeMetric("import_connect_flags_info", "Features negotiated between the import and the target, as a sorted comma-separated list of connect flags", append(labels, "flags"), 1, append(labelValues, strings.Join(listElements(flags), ","))...)
+			}
+			if timeouts, ok := values["rpcs.timeouts"]; ok {
+				value, err := strconv.ParseUint(timeouts, 10, 64)
+				if err != nil {
+					return err
+				}
+				ch <- s.counterMetric("import_rpc_timeouts_total", "Number of RPCs from the import to the target that timed out; for mgc this includes failed config log fetches", labels, float64(value), labelValues...)
+			}
+			if hasInterval && (component == "osc" || component == "mdc") {
+				ch <- s.gaugeMetric("import_ping_interval_seconds", "Interval in seconds at which the client pings the target", labels, float64(interval), labelValues...)
+			}
+			if idle, ok := values["connection.idle"]; ok {
+				seconds, err := parseSeconds(idle)
+				if err != nil {
+					return err
+				}
+				ch <- s.gaugeMetric("import_idle_seconds", "Seconds since the import last received a reply, including to pings, from the target", labels, float64(seconds), labelValues...)
+			}
+			for field, helpText := range importTransactionFields {
+				raw, ok := values["transactions."+field]
+				if !ok {
+					continue
+				}
+				value, err := strconv.ParseUint(raw, 10, 64)
+				if err != nil {
+					return err
+				}
+				ch <- s.gaugeMetric("import_"+field+"_transno", helpText, labels, float64(value), labelValues...)
+			}
+		}
+	}
+	return nil
+}
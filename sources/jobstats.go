@@ -0,0 +1,146 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	jobStatsTopN = flag.Int("job-stats.top-n", 0, "Only export the N jobs with the most operations per target from job_stats; 0 exports every job.")
+
+	// jobStatRegex matches an operation line of a job_stats file, e.g.
+	//   open:            { samples:           1, unit:  usecs, min: 23, max: 23, sum: 23, sumsq: 529 }
+	// Older releases only report samples and unit.
+	jobStatRegex = regexp.MustCompile(`^\s*(\w+):\s*\{\s*(.*?)\s*\}`)
+)
+
+// jobStats holds the operations recorded for a single job in a job_stats file.
+type jobStats struct {
+	jobID   string
+	entries []statsEntry
+	samples uint64
+}
+
+// parseJobStats parses the YAML-formatted job_stats file into one jobStats
+// per job. Each operation is converted into a statsEntry so it can share the
+// unit handling of regular 'stats' files.
+func parseJobStats(contents string) (jobs []jobStats, err error) {
+	var job *jobStats
+	for _, line := range strings.Split(contents, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "- job_id:") {
+			// Newer releases quote job IDs that contain special characters.
+			jobID := strings.TrimSpace(strings.TrimPrefix(trimmed, "- job_id:"))
+			jobs = append(jobs, jobStats{jobID: strings.Trim(jobID, `"'`)})
+			job = &jobs[len(jobs)-1]
+			continue
+		}
+		if job == nil {
+			continue
+		}
+		match := jobStatRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		values := make(map[string]string)
+		for _, pair := range strings.Split(match[2], ",") {
+			parts := strings.SplitN(pair, ":", 2)
+			if len(parts) == 2 {
+				values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			}
+		}
+		samples, err := strconv.ParseUint(values["samples"], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if samples == 0 {
+			continue
+		}
+		job.samples += samples
+		// Lay the values out as a 'stats' file line:
+		// {name} {number of samples} 'samples' [{units}] {minimum} {maximum} {sum}
+		fields := []string{match[1], values["samples"], "samples", "[" + values["unit"] + "]"}
+		if values["min"] != "" && values["max"] != "" && values["sum"] != "" {
+			fields = append(fields, values["min"], values["max"], values["sum"])
+		}
+		job.entries = append(job.entries, statsEntry{name: match[1], fields: fields})
+	}
+	return jobs, nil
+}
+
+// topJobs returns the n jobs with the most operations, or every job if n is 0.
+func topJobs(jobs []jobStats, n int) []jobStats {
+	if n <= 0 || len(jobs) <= n {
+		return jobs
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].samples > jobs[j].samples
+	})
+	return jobs[:n]
+}
+
+// parseJobStatsFile exports the per-job operation counts and latencies from a
+// job_stats file, named after prefix and labeled by job and operation.
+func (s *lustreSource) parseJobStatsFile(nodeType string, prefix string, path string, handler func(string, string, string, string, string, string, prometheus.ValueType, float64)) (err error) {
+	_, nodeName, err := parseFileElements(path)
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	jobs, err := parseJobStats(string(contents))
+	if err != nil {
+		return err
+	}
+	for _, job := range topJobs(jobs, *jobStatsTopN) {
+		for _, entry := range job.entries {
+			if !operationAllowed(s.statsOperations, entry.name) {
+				continue
+			}
+			stats, err := entry.operationStats(prefix)
+			if err != nil {
+				return err
+			}
+			for _, stat := range stats {
+				handler(nodeType, nodeName, job.jobID, entry.name, stat.name, stat.helpText, stat.valueType, stat.value)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *lustreSource) jobMetric(nodeType string, nodeName string, jobID string, operation string, name string, helpText string, valueType prometheus.ValueType, value float64) prometheus.Metric {
+	labels, labelValues := targetLabels(nodeType, nodeName)
+	return prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", name),
+			helpText,
+			append(labels, "job_id", "operation"),
+			nil,
+		),
+		valueType,
+		value,
+		append(labelValues, jobID, operation)...,
+	)
+}
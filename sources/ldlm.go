@@ -0,0 +1,61 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// mdtNamespaces returns the ldlm namespace directories of the MDTs, named
+// like mdt-lustrefs-MDT0000_UUID, from the proc tree or, on newer releases,
+// the sysfs tree.
+func (s *lustreSource) mdtNamespaces() (paths []string, err error) {
+	for _, tree := range []sourceTree{procTree, sysfsTree} {
+		paths, err = filepath.Glob(filepath.Join(s.basePaths[tree], "ldlm/namespaces/mdt-*_UUID"))
+		if err != nil || paths != nil {
+			return paths, err
+		}
+	}
+	return nil, nil
+}
+
+// mdtLockMetrics exports the lock count and lock timeouts of the ldlm
+// namespace of every MDT, to find metadata lock contention.
+func (s *lustreSource) mdtLockMetrics(ch chan<- prometheus.Metric) error {
+	paths, err := s.mdtNamespaces()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		mdt := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "mdt-"), "_UUID")
+		if _, ok := parseTargetName(mdt); !ok || !s.targets.allowed(mdt) {
+			continue
+		}
+		labels, labelValues := serverTargetLabels(mdt)
+		if count, ok, err := s.readTargetValue(path, "lock_count"); err != nil {
+			return err
+		} else if ok {
+			ch <- s.gaugeMetric("mdt_lock_count", "Number of locks currently granted in the ldlm namespace of the MDT", labels, float64(count), labelValues...)
+		}
+		if timeouts, ok, err := s.readTargetValue(path, "lock_timeouts"); err != nil {
+			return err
+		} else if ok {
+			ch <- s.counterMetric("mdt_lock_timeouts_total", "Number of lock callbacks in the ldlm namespace of the MDT that timed out", labels, float64(timeouts), labelValues...)
+		}
+	}
+	return nil
+}
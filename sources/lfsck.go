@@ -0,0 +1,92 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	lfsckStatusHelp  string = "Set to 1 for the phase an active LFSCK scan is in; absent when no scan is running."
+	lfsckCheckedHelp string = "Number of objects checked so far in the current phase of an active LFSCK scan."
+)
+
+// parseKeyValueFile parses files made of 'key: value' lines, such as the
+// LFSCK and recovery status files.
+func parseKeyValueFile(contents string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(contents, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return values
+}
+
+// parseLFSCK reports the phase and progress of an active LFSCK scan from an
+// lfsck_layout or lfsck_namespace file. Nothing is reported while idle.
+func (s *lustreSource) parseLFSCK(nodeType string, path string, handler func(string, string, string, string, string, float64)) (err error) {
+	name, nodeName, err := parseFileElements(path)
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	values := parseKeyValueFile(string(contents))
+	phase := values["status"]
+	if !strings.HasPrefix(phase, "scanning-") {
+		return nil
+	}
+	scanType := strings.TrimPrefix(name, "lfsck_")
+	handler(nodeType, nodeName, scanType, phase, "lfsck_status", 1)
+
+	// checked_phase1 and checked_phase2 count the objects checked so far
+	checked, ok := values["checked_"+strings.TrimPrefix(phase, "scanning-")]
+	if !ok {
+		return nil
+	}
+	value, err := strconv.ParseUint(checked, 10, 64)
+	if err != nil {
+		return err
+	}
+	handler(nodeType, nodeName, scanType, phase, "lfsck_checked_objects", float64(value))
+	return nil
+}
+
+func (s *lustreSource) lfsckMetric(nodeType string, nodeName string, scanType string, phase string, name string, value float64) prometheus.Metric {
+	helpText := lfsckStatusHelp
+	if name == "lfsck_checked_objects" {
+		helpText = lfsckCheckedHelp
+	}
+	labels, labelValues := targetLabels(nodeType, nodeName)
+	return prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", name),
+			helpText,
+			append(labels, "type", "phase"),
+			nil,
+		),
+		prometheus.GaugeValue,
+		value,
+		append(labelValues, scanType, phase)...,
+	)
+}
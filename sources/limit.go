@@ -0,0 +1,84 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	maxSeries = flag.Int("max-series", 0, "Maximum number of series the procfs source emits per scrape; further series are dropped. 0 disables the limit.")
+)
+
+// seriesLimiter forwards at most max metrics to the wrapped channel and
+// drops the rest.
+type seriesLimiter struct {
+	in      chan prometheus.Metric
+	done    chan struct{}
+	limited bool
+}
+
+func newSeriesLimiter(out chan<- prometheus.Metric, max int) *seriesLimiter {
+	l := &seriesLimiter{
+		in:   make(chan prometheus.Metric),
+		done: make(chan struct{}),
+	}
+	go func() {
+		sent := 0
+		for metric := range l.in {
+			if sent >= max {
+				l.limited = true
+				continue
+			}
+			out <- metric
+			sent++
+		}
+		close(l.done)
+	}()
+	return l
+}
+
+// close waits for every pending metric to be handled and reports whether any
+// were dropped.
+func (l *seriesLimiter) close() bool {
+	close(l.in)
+	<-l.done
+	return l.limited
+}
+
+// cardinalityRank orders templates from the lowest to the highest number of
+// series they are expected to produce, so a series limit drops the most
+// numerous ones first.
+func cardinalityRank(metric lustreProcMetric) int {
+	switch {
+	case metric.name == "job_stats":
+		return 3
+	case metric.opsPrefix != "" || metric.name == "stats" || metric.name == "brw_stats":
+		return 2
+	case capacityMetrics[metric.name]:
+		return 0
+	}
+	return 1
+}
+
+// sortByCardinality orders the templates by cardinalityRank, keeping the
+// existing order within each rank.
+func (s *lustreSource) sortByCardinality() {
+	sort.SliceStable(s.lustreProcMetrics, func(i, j int) bool {
+		return cardinalityRank(s.lustreProcMetrics[i]) < cardinalityRank(s.lustreProcMetrics[j])
+	})
+}
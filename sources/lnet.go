@@ -0,0 +1,360 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var lnetPeersEnabled = flag.Bool("collector.lnet-peers", false, "Collect the credits and queue of every LNET peer. Produces one series per peer NID and CPT.")
+
+// lnetStat describes one column of /proc/sys/lnet/stats, which holds a single
+// line of space-separated counters:
+// msgs_alloc msgs_max errors send_count recv_count route_count drop_count send_length recv_length route_length drop_length
+// [0]        [1]      [2]    [3]        [4]        [5]         [6]        [7]         [8]         [9]          [10]
+// The counters from errors to drop_count are 32-bit on older releases and
+// wrap around; the lengths are 64-bit.
+type lnetStat struct {
+	index     int
+	name      string
+	helpText  string
+	valueType prometheus.ValueType
+	width32   bool
+}
+
+var lnetStats = []lnetStat{
+	{index: 0, name: "allocated_messages", helpText: "Number of LNET messages currently allocated", valueType: prometheus.GaugeValue},
+	{index: 1, name: "allocated_messages_max", helpText: "Highest number of LNET messages allocated at once", valueType: prometheus.GaugeValue},
+	{index: 2, name: "errors_total", helpText: "Total number of LNET errors", valueType: prometheus.CounterValue, width32: true},
+	{index: 3, name: "send_count_total", helpText: "Total number of messages LNET has sent", valueType: prometheus.CounterValue, width32: true},
+	{index: 4, name: "receive_count_total", helpText: "Total number of messages LNET has received", valueType: prometheus.CounterValue, width32: true},
+	{index: 5, name: "route_count_total", helpText: "Total number of messages LNET has routed", valueType: prometheus.CounterValue, width32: true},
+	{index: 6, name: "drop_count_total", helpText: "Total number of messages LNET has dropped", valueType: prometheus.CounterValue, width32: true},
+	{index: 7, name: "send_length_bytes_total", helpText: "Total number of bytes in messages LNET has sent", valueType: prometheus.CounterValue},
+	{index: 8, name: "receive_length_bytes_total", helpText: "Total number of bytes in messages LNET has received", valueType: prometheus.CounterValue},
+	{index: 9, name: "route_length_bytes_total", helpText: "Total number of bytes in messages LNET has routed", valueType: prometheus.CounterValue},
+	{index: 10, name: "drop_length_bytes_total", helpText: "Total number of bytes in messages LNET has dropped", valueType: prometheus.CounterValue},
+}
+
+func init() {
+	Factories["lnet"] = NewLNETSource
+}
+
+type lnetSource struct {
+	basePath string
+	wraps    *wrapTracker
+}
+
+func NewLNETSource() (LustreSource, error) {
+	var l lnetSource
+	l.basePath = procFilePath("sys", "lnet")
+	l.wraps = newWrapTracker()
+	return &l, nil
+}
+
+func (s *lnetSource) Update(ctx context.Context, ch chan<- prometheus.Metric) (err error) {
+	if err := s.updateStats(ch); err != nil {
+		return err
+	}
+	if err := s.updateRouters(ch); err != nil {
+		return err
+	}
+	if err := s.updateLocalNIDs(ch); err != nil {
+		return err
+	}
+	if err := s.updateNIs(ch); err != nil {
+		return err
+	}
+	return s.updatePeers(ch)
+}
+
+// readLNETFile reads a file below the LNET proc directory. ok is false if
+// LNET isn't loaded on this node or the file can't be read.
+func (s *lnetSource) readLNETFile(name string) (contents string, ok bool, err error) {
+	raw, err := ioutil.ReadFile(filepath.Join(s.basePath, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		if os.IsPermission(err) {
+			permissionErrors.WithLabelValues("lnet").Inc()
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return string(raw), true, nil
+}
+
+func (s *lnetSource) updateStats(ch chan<- prometheus.Metric) error {
+	statsFile, ok, err := s.readLNETFile("stats")
+	if err != nil || !ok {
+		return err
+	}
+	fields := strings.Fields(statsFile)
+	for _, stat := range lnetStats {
+		if stat.index >= len(fields) {
+			return fmt.Errorf("lnet stats has %d fields, expected at least %d", len(fields), stat.index+1)
+		}
+		value, err := strconv.ParseUint(fields[stat.index], 10, 64)
+		if err != nil {
+			return err
+		}
+		if stat.width32 {
+			value = s.wraps.extend(s.lnetMetricName(stat.name), value)
+		}
+		ch <- s.lnetMetric(stat.name, stat.helpText, stat.valueType, float64(value))
+	}
+	return nil
+}
+
+// updateRouters exports the router checker state of every router in the
+// routers file. The state column is named 'alive' in newer releases and
+// 'state' in older ones; non-routed nodes list no routers.
+func (s *lnetSource) updateRouters(ch chan<- prometheus.Metric) error {
+	routersFile, ok, err := s.readLNETFile("routers")
+	if err != nil || !ok {
+		return err
+	}
+	lines := strings.Split(routersFile, "\n")
+	header := strings.Fields(lines[0])
+	stateColumn, routerColumn := -1, -1
+	for i, name := range header {
+		switch name {
+		case "alive", "state":
+			stateColumn = i
+		case "router":
+			routerColumn = i
+		}
+	}
+	if stateColumn < 0 || routerColumn < 0 {
+		return fmt.Errorf("lnet routers header %q has no state or router column", lines[0])
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != len(header) {
+			continue
+		}
+		for _, metric := range enumMetrics(s.lnetMetricName("router_state"), "Router checker state of the LNET router, 1 for the current state", []string{"nid"}, []string{fields[routerColumn]}, []string{"up", "down"}, fields[stateColumn]) {
+			ch <- metric
+		}
+	}
+	return nil
+}
+
+// updateLocalNIDs exports an info metric for every NID of this node listed
+// in the nis file, so Lustre targets can be matched with LNET metrics keyed
+// by NID. The loopback NID is skipped.
+func (s *lnetSource) updateLocalNIDs(ch chan<- prometheus.Metric) error {
+	nisFile, ok, err := s.readLNETFile("nis")
+	if err != nil || !ok {
+		return err
+	}
+	lines := strings.Split(nisFile, "\n")
+	header := strings.Fields(lines[0])
+	if len(header) == 0 || header[0] != "nid" {
+		return fmt.Errorf("lnet nis header %q has no nid column", lines[0])
+	}
+	seen := make(map[string]bool)
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasSuffix(fields[0], "@lo") || seen[fields[0]] {
+			continue
+		}
+		// A NI is listed once per CPT, so the same NID can appear repeatedly.
+		seen[fields[0]] = true
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				prometheus.BuildFQName(Namespace, "", "server_nid_info"),
+				"Local LNET NID of the server, always 1",
+				[]string{"nid"},
+				nil,
+			),
+			prometheus.GaugeValue,
+			1,
+			fields[0],
+		)
+	}
+	return nil
+}
+
+// lnetColumn is a numeric column of a tabular LNET proc file, exported as a
+// gauge labeled by NID. position picks among columns sharing a header name.
+type lnetColumn struct {
+	header   string
+	position int
+	name     string
+	helpText string
+}
+
+var (
+	// The nis file lists every NI once per CPT:
+	// nid                      status alive refs peer  rtr   max    tx   min
+	// 10.0.0.1@tcp                 up    -1    1    8    0   256   256   252
+	lnetNIColumns = []lnetColumn{
+		{header: "refs", name: "ni_refs", helpText: "Number of references held on the LNET network interface"},
+		{header: "peer", name: "ni_peer_credits", helpText: "Number of send credits each peer gets on the LNET network interface"},
+		{header: "rtr", name: "ni_peer_router_credits", helpText: "Number of router buffer credits each peer gets on the LNET network interface"},
+		{header: "max", name: "ni_max_credits", helpText: "Total number of send credits of the LNET network interface"},
+		{header: "tx", name: "ni_credits", helpText: "Number of send credits currently available on the LNET network interface"},
+		{header: "min", name: "ni_min_credits", helpText: "Lowest number of send credits ever available on the LNET network interface"},
+	}
+	// The peers file has two min columns, for router and send credits:
+	// nid                      refs state  last   max   rtr   min    tx   min queue
+	// 10.0.0.2@tcp                1    NA    -1     8     8     8     8     6 0
+	lnetPeerColumns = []lnetColumn{
+		{header: "refs", name: "peer_refs", helpText: "Number of references held on the LNET peer"},
+		{header: "max", name: "peer_max_credits", helpText: "Total number of send credits of the LNET peer"},
+		{header: "rtr", name: "peer_router_credits", helpText: "Number of router buffer credits currently available to the LNET peer"},
+		{header: "min", position: 0, name: "peer_router_min_credits", helpText: "Lowest number of router buffer credits ever available to the LNET peer"},
+		{header: "tx", name: "peer_credits", helpText: "Number of send credits currently available to the LNET peer; negative when messages are queued"},
+		{header: "min", position: 1, name: "peer_min_credits", helpText: "Lowest number of send credits ever available to the LNET peer"},
+		{header: "queue", name: "peer_queued_bytes", helpText: "Number of bytes queued for sending to the LNET peer"},
+	}
+)
+
+// columnIndexes returns the index of each column in header, or an error if
+// one is missing.
+func columnIndexes(file string, header []string, columns []lnetColumn) ([]int, error) {
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		indexes[i] = -1
+		position := 0
+		for j, name := range header {
+			if name != column.header {
+				continue
+			}
+			if position == column.position {
+				indexes[i] = j
+				break
+			}
+			position++
+		}
+		if indexes[i] < 0 {
+			return nil, fmt.Errorf("lnet %s header %q has no %s column", file, strings.Join(header, " "), column.header)
+		}
+	}
+	return indexes, nil
+}
+
+// updateNIs exports the credits of every local network interface, labeled by
+// NID and by CPT, numbered in the order the file lists them. The nis table
+// has no drop columns, so message drops are only available for LNET as a
+// whole, from the stats file.
+func (s *lnetSource) updateNIs(ch chan<- prometheus.Metric) error {
+	nisFile, ok, err := s.readLNETFile("nis")
+	if err != nil || !ok {
+		return err
+	}
+	lines := strings.Split(nisFile, "\n")
+	header := strings.Fields(lines[0])
+	indexes, err := columnIndexes("nis", header, lnetNIColumns)
+	if err != nil {
+		return err
+	}
+	cpts := make(map[string]int)
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != len(header) || strings.HasSuffix(fields[0], "@lo") {
+			continue
+		}
+		nid := fields[0]
+		cpt := strconv.Itoa(cpts[nid])
+		cpts[nid]++
+		for i, column := range lnetNIColumns {
+			value, err := strconv.ParseFloat(fields[indexes[i]], 64)
+			if err != nil {
+				return err
+			}
+			ch <- s.lnetGauge(column.name, column.helpText, []string{"nid", "cpt"}, value, nid, cpt)
+		}
+	}
+	return nil
+}
+
+// updatePeers exports the credits and queue of every LNET peer when the
+// peers collector is enabled, labeled by NID and by CPT, numbered in the
+// order the file lists them.
+func (s *lnetSource) updatePeers(ch chan<- prometheus.Metric) error {
+	if !*lnetPeersEnabled {
+		return nil
+	}
+	peersFile, ok, err := s.readLNETFile("peers")
+	if err != nil || !ok {
+		return err
+	}
+	lines := strings.Split(peersFile, "\n")
+	header := strings.Fields(lines[0])
+	indexes, err := columnIndexes("peers", header, lnetPeerColumns)
+	if err != nil {
+		return err
+	}
+	cpts := make(map[string]int)
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != len(header) {
+			continue
+		}
+		nid := fields[0]
+		cpt := strconv.Itoa(cpts[nid])
+		cpts[nid]++
+		for i, column := range lnetPeerColumns {
+			value, err := strconv.ParseFloat(fields[indexes[i]], 64)
+			if err != nil {
+				return err
+			}
+			ch <- s.lnetGauge(column.name, column.helpText, []string{"nid", "cpt"}, value, nid, cpt)
+		}
+	}
+	return nil
+}
+
+func (s *lnetSource) lnetGauge(name string, helpText string, labels []string, value float64, labelValues ...string) prometheus.Metric {
+	return prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			s.lnetMetricName(name),
+			helpText,
+			labels,
+			nil,
+		),
+		prometheus.GaugeValue,
+		value,
+		labelValues...,
+	)
+}
+
+func (s *lnetSource) lnetMetricName(name string) string {
+	return prometheus.BuildFQName(Namespace, "lnet", name)
+}
+
+func (s *lnetSource) lnetMetric(name string, helpText string, valueType prometheus.ValueType, value float64) prometheus.Metric {
+	return prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			s.lnetMetricName(name),
+			helpText,
+			nil,
+			nil,
+		),
+		valueType,
+		value,
+	)
+}
@@ -0,0 +1,43 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The peers file lists a peer once per CPT it is known on.
+func TestLNETPeersPerCPT(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"sys/lnet/peers": "nid                      refs state  last   max   rtr   min    tx   min queue\n" +
+			"10.0.0.2@tcp                1    NA    -1     8     8     8     8     6 0\n" +
+			"10.0.0.2@tcp                1    NA    -1     8     8     8     5     4 0\n",
+	})
+	for _, enabled := range []bool{false, true} {
+		setBoolFlag(t, lnetPeersEnabled, enabled)
+		registry := prometheus.NewRegistry()
+		if err := registry.Register(sourceCollector{t: t, source: &lnetSource{basePath: root + "/sys/lnet", wraps: newWrapTracker()}}); err != nil {
+			t.Fatal(err)
+		}
+		for cpt, want := range map[string]float64{"0": 8, "1": 5} {
+			value, found := gatherValue(t, registry, "lustre_lnet_peer_credits", map[string]string{"nid": "10.0.0.2@tcp", "cpt": cpt})
+			if found != enabled || (enabled && value != want) {
+				t.Errorf("with --collector.lnet-peers=%v, peer_credits{cpt=%q} = %v (found %v), want %v", enabled, cpt, value, found, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// targetOBD is one line of a lod target_obd file, e.g.
+// "1: lustrefs-OST0001_UUID INACTIVE".
+type targetOBD struct {
+	target string
+	active bool
+}
+
+func parseTargetOBD(contents string) (targets []targetOBD) {
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+		targets = append(targets, targetOBD{
+			target: strings.TrimSuffix(fields[1], "_UUID"),
+			active: fields[2] == "ACTIVE",
+		})
+	}
+	return targets
+}
+
+// lodMetrics exports whether each OST is active for object allocation by
+// the LOD device of every MDT. Each MDT keeps its own view, so the series are
+// labeled by the MDT like its other metrics, with the OST in an 'ost' label.
+func (s *lustreSource) lodMetrics(ch chan<- prometheus.Metric) error {
+	paths, err := filepath.Glob(filepath.Join(s.basePaths[procTree], "lod/*-mdtlov/target_obd"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		mdt := strings.TrimSuffix(filepath.Base(filepath.Dir(path)), "-mdtlov")
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				continue
+			}
+			return err
+		}
+		labels, labelValues := serverTargetLabels(mdt)
+		for _, obd := range parseTargetOBD(string(contents)) {
+			if _, ok := parseTargetName(obd.target); !ok || !s.targets.allowed(obd.target) {
+				continue
+			}
+			ch <- s.gaugeMetric("lod_ost_active", "Whether the MDT allocates new objects on the OST (1) or the OST is inactive (0)", append(labels, "ost"), boolToFloat(obd.active), append(labelValues, obd.target)...)
+		}
+	}
+	return nil
+}
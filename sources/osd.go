@@ -0,0 +1,101 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// osdBackends lists the OSD directories and the backend each belongs to.
+var osdBackends = map[string]string{
+	"osd-ldiskfs": "ldiskfs",
+	"osd-zfs":     "zfs",
+}
+
+// readTargetValue reads a single-value file from a target directory. ok is
+// false if the file is missing, unreadable or holds a placeholder.
+func (s *lustreSource) readTargetValue(dir string, name string) (value uint64, ok bool, err error) {
+	contents, err := s.readSingleFile(name, filepath.Join(dir, name))
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	value, skip, err := parseSingleValue(string(contents))
+	if err != nil || skip {
+		return 0, false, err
+	}
+	return value, true, nil
+}
+
+// osdObjectMetrics exports the object counts reported by the OSD layer of
+// each target. On ZFS these count dnodes rather than inodes, so they can
+// differ from the filesfree and filestotal of the target.
+func (s *lustreSource) osdObjectMetrics(ch chan<- prometheus.Metric) error {
+	for dir, backend := range osdBackends {
+		targets, err := filepath.Glob(filepath.Join(s.basePaths[procTree], dir, "*"))
+		if err != nil {
+			return err
+		}
+		for _, path := range targets {
+			target := filepath.Base(path)
+			if !s.targets.allowed(target) {
+				continue
+			}
+			free, hasFree, err := s.readTargetValue(path, "filesfree")
+			if err != nil {
+				return err
+			}
+			total, hasTotal, err := s.readTargetValue(path, "filestotal")
+			if err != nil {
+				return err
+			}
+			// --backend-label already adds the backend to the target labels.
+			labels, labelValues := serverTargetLabels(target)
+			if !hasLabel(labels, "backend") {
+				labels, labelValues = append(labels, "backend"), append(labelValues, backend)
+			}
+			if hasFree {
+				ch <- s.gaugeMetric("osd_objects_free", "Number of objects that can still be allocated by the OSD backend of the target", labels, float64(free), labelValues...)
+			}
+			if hasFree && hasTotal && total >= free {
+				ch <- s.gaugeMetric("osd_objects_used", "Number of objects allocated by the OSD backend of the target", labels, float64(total-free), labelValues...)
+			}
+		}
+	}
+	return nil
+}
+
+// detectBackends records the OSD backend of every target for --backend-label.
+// OSD directories are named after the target, e.g. osd-zfs/lustrefs-OST0000.
+func (s *lustreSource) detectBackends() error {
+	backends := make(map[string]string)
+	for dir, backend := range osdBackends {
+		targets, err := filepath.Glob(filepath.Join(s.basePaths[procTree], dir, "*"))
+		if err != nil {
+			return err
+		}
+		for _, path := range targets {
+			backends[filepath.Base(path)] = backend
+		}
+	}
+	targetBackendsMu.Lock()
+	targetBackends = backends
+	targetBackendsMu.Unlock()
+	return nil
+}
@@ -14,14 +14,20 @@
 package sources
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
 )
 
 const (
@@ -31,6 +37,9 @@ const (
 	minimumHelp string = "The minimum value retrieved for the given metric."
 	totalHelp   string = "The sum of all values collected for the given metric."
 
+	// Help text shared by the OSS and MDS 'degraded' files
+	degradedHelp string = "Binary indicator as to whether or not the target is degraded - 0 for not degraded, 1 for degraded"
+
 	// Help text dedicated to the 'brw_stats' file
 	pagesPerBlockRWHelp    string = "Total number of pages per RPC."
 	discontiguousPagesHelp string = "Total number of logical discontinuities per RPC."
@@ -39,21 +48,148 @@ const (
 	diskIOsInFlightHelp    string = "Current number of I/O operations that are processing during the snapshot."
 )
 
+var (
+	hostProcfsPath = flag.String("path.procfs", "/proc", "Procfs mountpoint; the Lustre, LNET and slabinfo paths are derived from it unless set explicitly.")
+	procfsPath     = flag.String("path.lustre-procfs", "", "Root of the Lustre proc tree (default <path.procfs>/fs/lustre).")
+	sysfsPath      = flag.String("path.lustre-sysfs", "/sys/fs/lustre", "Root of the Lustre sysfs tree.")
+	debugfsPath    = flag.String("path.lustre-debugfs", "/sys/kernel/debug/lustre", "Root of the Lustre debugfs tree.")
+
+	echoEnabled   = flag.Bool("collector.echo", false, "Collect stats from obdecho/echo_client test devices, for benchmarking nodes.")
+	procfsTimeout = flag.Duration("collector.procfs-timeout", 0, "Maximum time the procfs source spends reading files per scrape before returning what it has gathered; 0 disables the limit.")
+)
+
+// ProcfsBasePath returns the root of the Lustre proc tree read by the procfs
+// source.
+func ProcfsBasePath() string {
+	if *procfsPath != "" {
+		return *procfsPath
+	}
+	return procFilePath("fs", "lustre")
+}
+
+// procFilePath returns the path of a file below the procfs mountpoint, so
+// that a host /proc mounted into a container can be used.
+func procFilePath(elem ...string) string {
+	return filepath.Join(append([]string{*hostProcfsPath}, elem...)...)
+}
+
+// OptionalCollectors reports which of the optional procfs collectors are
+// enabled by flags.
+func OptionalCollectors() map[string]bool {
+	return map[string]bool{
+		"echo":    *echoEnabled,
+		"exports": *exportsEnabled,
+		"quota":   *quotaEnabled,
+	}
+}
+
+// sentinelValue describes how a known non-numeric proc file value should be
+// interpreted: either mapped to a number, or skipped entirely.
+type sentinelValue struct {
+	value uint64
+	skip  bool
+}
+
+// sentinelValues maps placeholder strings that Lustre writes in place of a
+// number to their numeric equivalent. Add new entries here as other formats
+// are encountered.
+var sentinelValues = map[string]sentinelValue{
+	"disabled": {value: 0},
+	"enabled":  {value: 1},
+	"off":      {value: 0},
+	"on":       {value: 1},
+	"N/A":      {skip: true},
+	"none":     {skip: true},
+}
+
+var (
+	// statsFieldSeparator splits a 'stats' file line into its fields
+	statsFieldSeparator = regexp.MustCompile(`\s+`)
+
+	skippedValues = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "exporter",
+			Name:      "skipped_values_total",
+			Help:      "Total number of proc file values skipped because they held a placeholder instead of a number.",
+		},
+		[]string{"metric"},
+	)
+
+	parseErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "exporter",
+			Name:      "parse_errors_total",
+			Help:      "Total number of files that could not be read or parsed.",
+		},
+		[]string{"source", "metric"},
+	)
+
+	globErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "exporter",
+			Name:      "glob_errors_total",
+			Help:      "Total number of times the path pattern for a metric could not be expanded.",
+		},
+		[]string{"metric"},
+	)
+)
+
+// sourceTree identifies which filesystem tree a metric's file lives in.
+type sourceTree int
+
+const (
+	procTree         sourceTree = iota //Only under /proc/fs/lustre
+	sysfsTree                          //Only under /sys/fs/lustre
+	procAndSysfsTree                   //Under /proc/fs/lustre, or /sys/fs/lustre on versions that moved it
+	debugfsTree                        //Only under /sys/kernel/debug/lustre; no template reads from it yet
+)
+
+// valueLayout describes how to read a single-value file whose line holds
+// several space-separated values, such as a current and a default setting.
+// The zero value reads the whole file as one value.
+type valueLayout struct {
+	field int      //Position, counting from 1, of the field to read when names is empty
+	names []string //Metric name suffix for each field, emitting one metric per field; empty entries are skipped
+}
+
 type lustreProcMetric struct {
 	subsystem string
 	name      string
-	source    string //The node type (OSS, MDS, MGS)
+	source    string //The node type (OSS, MDS, MGS), or mount/target for client devices
 	path      string //Path to retreive metric from
 	helpText  string
+	valueType prometheus.ValueType
+	info      bool   //File holds a string exposed as a label on an info metric
+	opsPrefix string //When set, every line of the stats file is exported under this prefix with an operation label
+	tree      sourceTree
+	layout    valueLayout
+	fallbacks []string //Paths tried in order when nothing matches path, for versions that moved the file
 }
 
 func init() {
 	Factories["procfs"] = NewLustreSource
+	prometheus.MustRegister(skippedValues)
+	prometheus.MustRegister(globErrors)
+	prometheus.MustRegister(parseErrors)
 }
 
 type lustreSource struct {
 	lustreProcMetrics []lustreProcMetric
-	basePath          string
+	basePaths         map[sourceTree]string
+	rateOnly          map[string]bool
+	rates             *rateTracker
+	capacityCache     *fileCache
+	statsOperations   map[string]bool
+	errorLog          *errorLogLimiter
+	targets           targetFilter
+	staleness         *stalenessTracker
+	scheduler         *collectorScheduler
+	guard             *collectorGuard
+	quotaTypes        map[string]bool
+	quotaIDs          idRange
 }
 
 func newLustreProcMetric(name string, source string, path string, helpText string) lustreProcMetric {
@@ -62,6 +198,8 @@ func newLustreProcMetric(name string, source string, path string, helpText strin
 	m.source = source
 	m.path = path
 	m.helpText = helpText
+	m.valueType = prometheus.CounterValue
+	m.tree = procTree
 
 	return m
 }
@@ -72,7 +210,6 @@ func (s *lustreSource) generateOSSMetricTemplates() error {
 			"blocksize":            "Filesystem block size in bytes",
 			"brw_size":             "Block read/write size in bytes",
 			"brw_stats":            "A collection of block read/write statistics",
-			"degraded":             "Binary indicator as to whether or not the pool is degraded - 0 for not degraded, 1 for degraded",
 			"filesfree":            "The number of inodes (objects) available",
 			"filestotal":           "The maximum number of inodes (objects) the filesystem can hold",
 			"grant_compat_disable": "Binary indicator as to whether clients with OBD_CONNECT_GRANT_PARAM setting will be granted space",
@@ -81,22 +218,83 @@ func (s *lustreSource) generateOSSMetricTemplates() error {
 			"kbytesavail":          "Number of kilobytes readily available in the pool",
 			"kbytesfree":           "Number of kilobytes allocated to the pool",
 			"kbytestotal":          "Capacity of the pool in kilobytes",
+			"lfsck_layout":         "Phase and progress of an active LFSCK layout scan",
 			"lfsck_speed_limit":    "Maximum operations per second LFSCK (Lustre filesystem verification) can run",
 			"num_exports":          "Total number of times the pool has been exported",
 			"precreate_batch":      "Maximum number of objects that can be included in a single transaction",
+			"recovery_status":      "Seconds remaining before recovery of the target times out, while recovery is in progress",
 			"recovery_time_hard":   "Maximum timeout 'recover_time_soft' can increment to for a single server",
 			"recovery_time_soft":   "Duration in seconds for a client to attempt to reconnect after a crash (automatically incremented if servers are still in an error state)",
 			"soft_sync_limit":      "Number of RPCs necessary before triggering a sync",
 			"stats":                "A collection of statistics specific to Lustre",
 			"sync_journal":         "Binary indicator as to whether or not the journal is set for asynchronous commits",
-			"tot_dirty":            "Total number of exports that have been marked dirty",
-			"tot_granted":          "Total number of exports that have been marked granted",
-			"tot_pending":          "Total number of exports that have been marked pending",
+			"uuid":                 "Stable UUID of the target",
+		},
+		"ost/OSS/*": map[string]string{
+			"timeouts": "Adaptive timeout estimates for the OSS service",
 		},
 	}
 	for path, _ := range metricMap {
 		for metric, helpText := range metricMap[path] {
 			newMetric := newLustreProcMetric(metric, "OSS", path, helpText)
+			newMetric.fallbacks = ossFallbackPaths(path, metric)
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
+	integrityMap := map[string]map[string]string{
+		"obdfilter/*": map[string]string{
+			"checksum_dump":          "Binary indicator as to whether the OST dumps pages to a file on a checksum error - 0 for disabled, 1 for enabled",
+			"checksum_t10pi_enforce": "Binary indicator as to whether the OST enforces T10-PI checksums - 0 for disabled, 1 for enabled",
+		},
+	}
+	// degraded is also exported for MDTs, so it must match their type and help.
+	stateMap := map[string]map[string]string{
+		"obdfilter/*": map[string]string{
+			"degraded": degradedHelp,
+		},
+	}
+	for path, _ := range stateMap {
+		for metric, helpText := range stateMap[path] {
+			newMetric := newLustreProcMetric(metric, "OSS", path, helpText)
+			newMetric.valueType = prometheus.GaugeValue
+			newMetric.fallbacks = ossFallbackPaths(path, metric)
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
+	grantMap := map[string]map[string]string{
+		"obdfilter/*": map[string]string{
+			"tot_dirty":   "Total bytes of dirty data clients hold against grants from the OST",
+			"tot_granted": "Total bytes of space the OST has granted to clients",
+			"tot_pending": "Total bytes of writes pending on the OST against client grants",
+		},
+	}
+	for path, _ := range grantMap {
+		for metric, helpText := range grantMap[path] {
+			newMetric := newLustreProcMetric(metric, "OSS", path, helpText)
+			newMetric.valueType = prometheus.GaugeValue
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
+	for path, _ := range integrityMap {
+		for metric, helpText := range integrityMap[path] {
+			newMetric := newLustreProcMetric(metric, "OSS", path, helpText)
+			newMetric.valueType = prometheus.GaugeValue
+			newMetric.tree = procAndSysfsTree
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
+	opsMap := map[string]map[string]string{
+		"osd-ldiskfs/*-OST*": map[string]string{
+			"stats": "osd_ldiskfs",
+		},
+		"obdfilter/*": map[string]string{
+			"job_stats": "job_io",
+		},
+	}
+	for path, _ := range opsMap {
+		for metric, prefix := range opsMap[path] {
+			newMetric := newLustreProcMetric(metric, "OSS", path, "")
+			newMetric.opsPrefix = prefix
 			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
 		}
 	}
@@ -126,6 +324,16 @@ func (s *lustreSource) generateMGSMetricTemplates() error {
 
 func (s *lustreSource) generateMDSMetricTemplates() error {
 	metricMap := map[string]map[string]string{
+		"mdd/*": map[string]string{
+			"lfsck_layout":    "Phase and progress of an active LFSCK layout scan",
+			"lfsck_namespace": "Phase and progress of an active LFSCK namespace scan",
+		},
+		"mds/MDS/*": map[string]string{
+			"timeouts": "Adaptive timeout estimates for the MDS service",
+		},
+		"mdt/*": map[string]string{
+			"recovery_status": "Seconds remaining before recovery of the target times out, while recovery is in progress",
+		},
 		"mds/MDS/osd": map[string]string{
 			"blocksize":            "Filesystem block size in bytes",
 			"filesfree":            "The number of inodes (objects) available",
@@ -142,82 +350,685 @@ func (s *lustreSource) generateMDSMetricTemplates() error {
 			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
 		}
 	}
+	tunableMap := map[string]map[string]string{
+		"mdt/*": map[string]string{
+			"degraded":                degradedHelp,
+			"identity_acquire_expire": "Time in seconds an identity upcall may take before it is considered failed",
+			"identity_expire":         "Time in seconds after which cached user identities expire",
+			"open_files_in_use":       "Number of files currently held open on the MDT",
+			"uuid":                    "Stable UUID of the target",
+		},
+		"osp/*": map[string]string{
+			"prealloc_last_id": "Last object ID the OST has precreated for the MDS",
+			"prealloc_next_id": "Next precreated object ID the MDS will assign",
+		},
+	}
+	for path, _ := range tunableMap {
+		for metric, helpText := range tunableMap[path] {
+			newMetric := newLustreProcMetric(metric, "MDS", path, helpText)
+			newMetric.valueType = prometheus.GaugeValue
+			newMetric.tree = procAndSysfsTree
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
+	// qos_maxage is printed with a unit, e.g. "5 Sec", so only its first field
+	// holds the value.
+	qosMaxAge := newLustreProcMetric("qos_maxage", "MDS", "lod/*", "Maximum age in seconds of the OST space usage data the MDT uses for object allocation")
+	qosMaxAge.valueType = prometheus.GaugeValue
+	qosMaxAge.tree = procAndSysfsTree
+	qosMaxAge.layout = valueLayout{field: 1}
+	s.lustreProcMetrics = append(s.lustreProcMetrics, qosMaxAge)
+	opsMap := map[string]map[string]string{
+		"mds/*/mdt_readpage": map[string]string{
+			"stats": "mdt_readpage",
+		},
+		"osd-ldiskfs/*-MDT*": map[string]string{
+			"stats": "osd_ldiskfs",
+		},
+		"mdt/*": map[string]string{
+			"job_stats": "job_metadata",
+			"md_stats":  "md_stats",
+		},
+	}
+	for path, _ := range opsMap {
+		for metric, prefix := range opsMap[path] {
+			newMetric := newLustreProcMetric(metric, "MDS", path, "")
+			newMetric.opsPrefix = prefix
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
+	infoMap := map[string]map[string]string{
+		"mdt/*": map[string]string{
+			"nosquash_nids": "NIDs exempt from root squashing on the MDT",
+		},
+	}
+	for path, _ := range infoMap {
+		for metric, helpText := range infoMap[path] {
+			newMetric := newLustreProcMetric(metric, "MDS", path, helpText)
+			newMetric.info = true
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
+	return nil
+}
+
+func (s *lustreSource) generateEchoMetricTemplates() error {
+	opsMap := map[string]map[string]string{
+		"echo_client/*": map[string]string{
+			"stats": "echo",
+		},
+		"obdecho/*": map[string]string{
+			"stats": "echo",
+		},
+	}
+	for path, _ := range opsMap {
+		for metric, prefix := range opsMap[path] {
+			newMetric := newLustreProcMetric(metric, "ECHO", path, "")
+			newMetric.opsPrefix = prefix
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
+	return nil
+}
+
+// generateClientMetricTemplates adds the llite metrics of client mounts. The
+// node type doubles as the label name, so these are labeled by mount.
+func (s *lustreSource) generateClientMetricTemplates() error {
+	metricMap := map[string]map[string]string{
+		"llite/*": map[string]string{
+			"blocksize":   "Filesystem block size in bytes",
+			"filesfree":   "The number of inodes (objects) available",
+			"filestotal":  "The maximum number of inodes (objects) the filesystem can hold",
+			"kbytesavail": "Number of kilobytes readily available in the pool",
+			"kbytesfree":  "Number of kilobytes allocated to the pool",
+			"kbytestotal": "Capacity of the pool in kilobytes",
+		},
+	}
+	for path, _ := range metricMap {
+		for metric, helpText := range metricMap[path] {
+			newMetric := newLustreProcMetric(metric, "mount", path, helpText)
+			newMetric.tree = procAndSysfsTree
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
+	tunableMap := map[string]map[string]string{
+		"llite/*": map[string]string{
+			"max_read_ahead_mb":          "Maximum amount of data in megabytes the client reads ahead across all files",
+			"max_read_ahead_per_file_mb": "Maximum amount of data in megabytes the client reads ahead for a single file",
+			"statfs_max_age":             "Maximum age in seconds of the cached filesystem statistics the client returns for statfs (df) before asking the servers again",
+		},
+	}
+	for path, _ := range tunableMap {
+		for metric, helpText := range tunableMap[path] {
+			newMetric := newLustreProcMetric(metric, "mount", path, helpText)
+			newMetric.valueType = prometheus.GaugeValue
+			newMetric.tree = procAndSysfsTree
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
+	oscMap := map[string]map[string]string{
+		"osc/*": map[string]string{
+			"destroys_in_flight": "Number of object destroy RPCs sent to the OST that have not completed yet",
+			"max_pages_per_rpc":  "Maximum number of pages the client sends to the OST in a single bulk RPC",
+			"max_rpcs_in_flight": "Maximum number of concurrent RPCs the client sends to the OST",
+			"rpc_stats":          "Number of RPCs currently in flight from the client to the OST",
+		},
+	}
+	for path, _ := range oscMap {
+		for metric, helpText := range oscMap[path] {
+			newMetric := newLustreProcMetric(metric, "target", path, helpText)
+			newMetric.valueType = prometheus.GaugeValue
+			newMetric.tree = procAndSysfsTree
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
+	clientOpsMap := map[string]map[string]string{
+		"llite/*": map[string]string{
+			"stats": "client",
+		},
+	}
+	for path, _ := range clientOpsMap {
+		for metric, prefix := range clientOpsMap[path] {
+			newMetric := newLustreProcMetric(metric, "mount", path, "")
+			newMetric.opsPrefix = prefix
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
+	opsMap := map[string]map[string]string{
+		"osc/*": map[string]string{
+			"stats": "osc",
+		},
+	}
+	for path, _ := range opsMap {
+		for metric, prefix := range opsMap[path] {
+			newMetric := newLustreProcMetric(metric, "target", path, "")
+			newMetric.opsPrefix = prefix
+			s.lustreProcMetrics = append(s.lustreProcMetrics, newMetric)
+		}
+	}
 	return nil
 }
 
 func NewLustreSource() (LustreSource, error) {
 	var l lustreSource
-	l.basePath = "/proc/fs/lustre"
+	if err := validateThreshold("space-low-threshold", *spaceLowThreshold); err != nil {
+		return nil, err
+	}
+	if err := validateThreshold("inodes-low-threshold", *inodesLowThreshold); err != nil {
+		return nil, err
+	}
+	l.basePaths = map[sourceTree]string{
+		procTree:    ProcfsBasePath(),
+		sysfsTree:   *sysfsPath,
+		debugfsTree: *debugfsPath,
+	}
+	l.rateOnly = parseNameList(*rateOnlyMetrics)
+	l.rates = newRateTracker()
+	l.errorLog = newErrorLogLimiter()
+	l.staleness = newStalenessTracker()
+	l.scheduler = newCollectorScheduler()
+	l.guard = newCollectorGuard()
+	l.statsOperations = parseNameList(*statsOperations)
+	targets, err := newTargetFilter(*onlyTarget, *includeTargets, *excludeTargets)
+	if err != nil {
+		return nil, err
+	}
+	l.targets = targets
+	l.quotaTypes = parseNameList(*quotaTypes)
+	for quotaType := range l.quotaTypes {
+		if _, ok := quotaAccountingFiles[quotaType]; !ok {
+			return nil, fmt.Errorf("quota.types must list user, group or project, got %q", quotaType)
+		}
+	}
+	if l.quotaIDs, err = parseIDRange(*quotaIDRange); err != nil {
+		return nil, err
+	}
+	if *statsNaming != statsNamingOperationMetric && *statsNaming != statsNamingOperationLabel {
+		return nil, fmt.Errorf("stats.naming must be %q or %q, got %q", statsNamingOperationMetric, statsNamingOperationLabel, *statsNaming)
+	}
+	if *targetAliasFile != "" {
+		aliases, err := loadTargetAliases(*targetAliasFile)
+		if err != nil {
+			return nil, err
+		}
+		targetAliases = aliases
+	}
+	if *capacityCacheInterval > 0 {
+		l.capacityCache = newFileCache(*capacityCacheInterval)
+	}
 	//control which node metrics you pull via flags
 	l.generateOSSMetricTemplates()
 	l.generateMGSMetricTemplates()
 	l.generateMDSMetricTemplates()
+	l.generateClientMetricTemplates()
+	if *echoEnabled {
+		l.generateEchoMetricTemplates()
+	}
+	if err := l.validateMetricTemplates(); err != nil {
+		return nil, err
+	}
+	l.sortByCardinality()
+	l.logPermissionProblems()
 	return &l, nil
 }
 
-func (s *lustreSource) Update(ch chan<- prometheus.Metric) (err error) {
-	metricType := "single"
+// validateMetricTemplates checks every template's path pattern so a malformed
+// pattern is reported at startup rather than on every scrape.
+func (s *lustreSource) validateMetricTemplates() error {
+	for _, metric := range s.lustreProcMetrics {
+		for _, path := range append([]string{metric.path}, metric.fallbacks...) {
+			if _, err := filepath.Match(filepath.Join(path, metric.name), ""); err != nil {
+				return fmt.Errorf("invalid path pattern %q for metric %q: %s", filepath.Join(path, metric.name), metric.name, err)
+			}
+		}
+	}
+	return nil
+}
 
+func (s *lustreSource) Update(ctx context.Context, ch chan<- prometheus.Metric) (err error) {
+	limited := false
+	if *maxSeries > 0 {
+		limiter := newSeriesLimiter(ch, *maxSeries)
+		err = s.update(ctx, limiter.in)
+		limited = limiter.close()
+	} else {
+		err = s.update(ctx, ch)
+	}
+	ch <- s.gaugeMetric("exporter_series_limited", "Whether the last scrape was truncated by --max-series (1) or not (0)", nil, boolToFloat(limited))
+	return err
+}
+
+func (s *lustreSource) update(ctx context.Context, ch chan<- prometheus.Metric) (err error) {
+	values := make(targetValues)
+	now := time.Now()
+	// Stale entries left behind after a failover can make the same target
+	// appear under two subtrees; only the first occurrence is collected.
+	seen := make(map[string]string)
+	duplicates := 0
+	// The guarded job_stats targets found during this scrape; the guard
+	// forgets the others.
+	jobStats := make(map[string]bool)
+
+	ch <- s.gaugeMetric("up", "Whether the Lustre proc tree is present and readable (1) or not (0)", nil, boolToFloat(s.procTreeReadable()))
+	if *backendLabel {
+		if err := s.detectBackends(); err != nil {
+			return err
+		}
+	}
+
+	// Once --collector.procfs-timeout passes, stop reading files, skip the
+	// optional collectors and emit what was gathered so far.
+	collectCtx := ctx
+	if *procfsTimeout > 0 {
+		var cancel context.CancelFunc
+		collectCtx, cancel = context.WithTimeout(ctx, *procfsTimeout)
+		defer cancel()
+	}
+	timedOut := false
+
+templates:
 	for _, metric := range s.lustreProcMetrics {
-		paths, err := filepath.Glob(filepath.Join(s.basePath, metric.path, metric.name))
-		if err != nil {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
+		if collectCtx.Err() != nil {
+			timedOut = true
+			break
+		}
+		paths, err := s.globMetric(metric)
+		if err != nil {
+			log.Errorf("Couldn't expand path pattern for %q: %s", metric.name, err)
+			globErrors.WithLabelValues(metric.name).Inc()
+			continue
+		}
 		if paths == nil {
 			continue
 		}
 		for _, path := range paths {
-			switch metric.name {
-			case "brw_stats":
-				err = s.parseBRWStats(metric.source, "brw_stats", path, metric.helpText, func(nodeType string, brwOperation string, brwSize string, nodeName string, name string, helpText string, value uint64) {
-					ch <- s.brwMetric(nodeType, brwOperation, brwSize, nodeName, name, helpText, value)
+			if collectCtx.Err() != nil {
+				timedOut = true
+				break templates
+			}
+			_, nodeName, err := parseFileElements(path)
+			if err != nil {
+				return err
+			}
+			if !s.targets.allowed(nodeName) {
+				continue
+			}
+			key := strings.Join([]string{metric.source, nodeName, metric.name, metric.opsPrefix}, "/")
+			if first, ok := seen[key]; ok {
+				log.Warnf("Duplicate %s target %q: ignoring %s, already collected from %s", metric.source, nodeName, path, first)
+				duplicates++
+				continue
+			}
+			seen[key] = path
+			collect := func(ch chan<- prometheus.Metric) error {
+				return s.scheduler.run(metric.name, metric.name+":"+path, now, ch, func(ch chan<- prometheus.Metric) error {
+					return s.collectFile(metric, path, values, now, ch)
 				})
+			}
+			// The job_stats parser handles free-form job IDs, so it can
+			// be disabled if it keeps failing. Each target is guarded on
+			// its own so one bad target does not disable the others.
+			if metric.name == "job_stats" {
+				guarded := metric.name + ":" + nodeName
+				jobStats[guarded] = true
+				err = s.guard.run(guarded, now, ch, collect)
 				if err != nil {
-					return err
-				}
-			default:
-				if metric.name == "stats" {
-					metricType = "stats"
+					collectorErrors.WithLabelValues(metric.name).Inc()
 				}
-				err = s.parseFile(metric.source, metricType, path, metric.helpText, func(nodeType string, nodeName string, name string, helpText string, value uint64) {
-					ch <- s.constMetric(nodeType, nodeName, name, helpText, value)
-				})
-				if err != nil {
-					return err
+			} else {
+				err = collect(ch)
+			}
+			if err != nil {
+				if os.IsPermission(err) {
+					log.Debugf("Skipping %s: %s", path, err)
+					permissionErrors.WithLabelValues(metric.source).Inc()
+					continue
 				}
+				parseErrors.WithLabelValues(metric.source, metric.name).Inc()
+				s.logParseError(path, err)
 			}
 		}
 	}
+	ch <- s.gaugeMetric("scrape_timed_out", "Whether the last scrape stopped reading files early because --collector.procfs-timeout passed (1) or not (0)", nil, boolToFloat(timedOut))
+	if !timedOut {
+		if err := s.targetHealth(now, ch); err != nil {
+			return err
+		}
+		s.runOptionalCollectors(now, ch)
+		s.guard.retain("job_stats:", jobStats)
+	}
+	s.derivedMetrics(values, ch)
+	if s.capacityCache != nil {
+		ch <- s.gaugeMetric("exporter_capacity_cache_age_seconds", "Age in seconds of the oldest capacity value served from the cache", nil, s.capacityCache.maxAge(time.Now()).Seconds())
+	}
+	for collector, age := range s.scheduler.maxAge(now) {
+		ch <- s.gaugeMetric("exporter_sampled_collector_age_seconds", "Age in seconds of the oldest metrics re-sent from the last run of a collector limited by --collector.<name>.every; its metrics are up to this stale", []string{"collector"}, age.Seconds(), collector)
+	}
+	for collector, disabled := range s.guard.disabled(now) {
+		ch <- s.gaugeMetric("exporter_collector_disabled", "Whether the collector is disabled after repeated failures (1) or running (0)", []string{"collector"}, boolToFloat(disabled), collector)
+	}
+	ch <- s.gaugeMetric("exporter_duplicate_targets", "Number of files ignored during the last scrape because the same target and metric was already collected from another path", nil, float64(duplicates))
 	return nil
 }
 
-func parseReadWriteBytes(operation string, regexString string, statsFile string) (metricMap map[string]map[string]string, err error) {
-	bytesRegex, err := regexp.Compile(regexString)
+// runOptionalCollectors runs the collectors that read files outside the
+// metric templates, each guarded so repeated failures disable it.
+func (s *lustreSource) runOptionalCollectors(now time.Time, ch chan<- prometheus.Metric) {
+	optionalCollectors := []struct {
+		name    string
+		collect func(chan<- prometheus.Metric) error
+	}{
+		{"mgs_filesystems", s.mgsFilesystems},
+		{"mds_cache", s.mdsCacheMetrics},
+		{"exports", func(ch chan<- prometheus.Metric) error {
+			return s.scheduler.run("exports", "exports", now, ch, func(ch chan<- prometheus.Metric) error {
+				return s.exportMetrics(now, ch)
+			})
+		}},
+		{"imports", s.importMetrics},
+		{"osd_objects", s.osdObjectMetrics},
+		{"mdt_locks", s.mdtLockMetrics},
+		{"quota", s.quotaMetrics},
+		{"capa", s.capaMetrics},
+		{"lod", s.lodMetrics},
+	}
+	for _, collector := range optionalCollectors {
+		if err := s.guard.run(collector.name, now, ch, collector.collect); err != nil {
+			log.Errorf("Collector %q failed: %s", collector.name, err)
+			collectorErrors.WithLabelValues(collector.name).Inc()
+		}
+	}
+}
+
+// procTreeReadable reports whether the Lustre proc tree exists and its
+// entries can be listed.
+func (s *lustreSource) procTreeReadable() bool {
+	dir, err := os.Open(s.basePaths[procTree])
 	if err != nil {
-		return nil, err
+		return false
 	}
+	defer dir.Close()
+	_, err = dir.Readdirnames(1)
+	return err == nil || err == io.EOF
+}
 
-	bytesString := bytesRegex.FindString(statsFile)
-	if len(bytesString) == 0 {
-		return nil, nil
+// collectFile parses a single file matched by metric and sends the resulting
+// metrics to ch.
+func (s *lustreSource) collectFile(metric lustreProcMetric, path string, values targetValues, now time.Time, ch chan<- prometheus.Metric) (err error) {
+	if metric.info {
+		return s.parseInfoFile(metric.source, path, metric.helpText, func(nodeType string, nodeName string, name string, helpText string, value string) {
+			ch <- s.infoMetric(nodeType, nodeName, name, helpText, value)
+		})
+	}
+	if metric.opsPrefix != "" && metric.name == "job_stats" {
+		return s.parseJobStatsFile(metric.source, metric.opsPrefix, path, func(nodeType string, nodeName string, jobID string, operation string, name string, helpText string, valueType prometheus.ValueType, value float64) {
+			ch <- s.jobMetric(nodeType, nodeName, jobID, operation, name, helpText, valueType, value)
+		})
+	}
+	if metric.hasSnapshot() {
+		return s.collectStatsFile(metric, path, values, now, ch)
+	}
+	switch metric.name {
+	case "brw_stats":
+		// Every bulk RPC is counted once in the pages per bulk r/w block,
+		// so its buckets add up to the total RPCs in each direction.
+		totals := make(map[string]uint64)
+		buckets := make(brwBuckets)
+		var bucketErr error
+		err := s.parseBRWStats(metric.source, "brw_stats", path, metric.helpText, func(nodeType string, brwOperation string, brwSize string, nodeName string, name string, helpText string, value uint64) {
+			if name == "pages_per_bulk_rw" {
+				totals[brwOperation] += value
+			}
+			if err := buckets.add(name, brwOperation, brwSize, value); err != nil {
+				bucketErr = err
+			}
+			ch <- s.brwMetric(nodeType, brwOperation, brwSize, nodeName, name, helpText, value)
+		})
+		if err != nil {
+			return err
+		}
+		if bucketErr != nil {
+			return bucketErr
+		}
+		_, nodeName, err := parseFileElements(path)
+		if err != nil {
+			return err
+		}
+		for _, histogram := range buckets.histograms(metric.source, nodeName) {
+			ch <- histogram
+		}
+		labels, labelValues := targetLabels(metric.source, nodeName)
+		for direction, value := range totals {
+			ch <- s.counterMetric("brw_rpcs_total", "Total number of bulk read or write RPCs handled by the target", append(labels, "direction"), float64(value), append(labelValues, direction)...)
+		}
+		return nil
+	case "uuid":
+		return s.parseInfoFile(metric.source, path, metric.helpText, func(nodeType string, nodeName string, name string, helpText string, value string) {
+			labels, labelValues := targetLabels(nodeType, nodeName)
+			ch <- s.gaugeMetric("target_uuid_info", helpText, append(labels, "uuid"), 1, append(labelValues, value)...)
+		})
+	case "rpc_stats":
+		return s.parseRPCsInFlight(metric.source, path, func(nodeType string, nodeName string, direction string, value uint64) {
+			labels, labelValues := targetLabels(nodeType, nodeName)
+			ch <- s.gaugeMetric("rpcs_in_flight", metric.helpText, append(labels, "direction"), float64(value), append(labelValues, direction)...)
+		})
+	case "recovery_status":
+		return s.parseRecoveryStatus(metric.source, path, func(nodeType string, nodeName string, value uint64) {
+			ch <- s.constMetric(nodeType, nodeName, "recovery_time_remaining_seconds", metric.helpText, prometheus.GaugeValue, float64(value))
+		})
+	case "timeouts":
+		return s.parseTimeouts(path, func(service string, estimate string, name string, helpText string, value float64) {
+			ch <- s.timeoutMetric(service, estimate, name, helpText, value)
+		})
+	case "lfsck_layout", "lfsck_namespace":
+		return s.parseLFSCK(metric.source, path, func(nodeType string, nodeName string, scanType string, phase string, name string, value float64) {
+			ch <- s.lfsckMetric(nodeType, nodeName, scanType, phase, name, value)
+		})
+	default:
+		return s.parseFile(metric.source, path, metric.helpText, metric.layout, func(nodeType string, nodeName string, name string, helpText string, value float64) {
+			values.add(nodeType, nodeName, name, value)
+			if s.rateOnly[name] {
+				s.emitRate(nodeType, nodeName, name, helpText, value, now, ch)
+				return
+			}
+			ch <- s.constMetric(nodeType, nodeName, name, helpText, metric.valueType, value)
+		})
 	}
+}
 
-	r, err := regexp.Compile(" +")
+// collectStatsFile parses a file with a snapshot_time header, reading it
+// once for both its snapshot time and its operations.
+func (s *lustreSource) collectStatsFile(metric lustreProcMetric, path string, values targetValues, now time.Time, ch chan<- prometheus.Metric) (err error) {
+	_, nodeName, err := parseFileElements(path)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	statsFile := string(contents)
+	if err := s.snapshotMetrics(metric, nodeName, statsFile, now, ch); err != nil {
+		return err
 	}
+	if metric.opsPrefix != "" {
+		return s.parseOperationStats(metric.source, metric.opsPrefix, nodeName, statsFile, func(nodeType string, nodeName string, operation string, name string, helpText string, valueType prometheus.ValueType, value float64) {
+			ch <- s.operationMetric(nodeType, nodeName, operation, name, helpText, valueType, value)
+		})
+	}
+	return s.parseStats(metric.source, nodeName, statsFile, func(nodeType string, nodeName string, operation string, suffix string, name string, helpText string, valueType prometheus.ValueType, value float64) {
+		values.add(nodeType, nodeName, name, value)
+		if s.rateOnly[name] {
+			s.emitRate(nodeType, nodeName, name, helpText, value, now, ch)
+			return
+		}
+		if *statsNaming == statsNamingOperationLabel {
+			ch <- s.operationMetric(nodeType, nodeName, operation, "stats_"+suffix, helpText, valueType, value)
+			return
+		}
+		ch <- s.constMetric(nodeType, nodeName, name, helpText, valueType, value)
+	})
+}
 
-	metricMap = make(map[string]map[string]string)
-	bytesSplit := r.Split(bytesString, -1)
-	// bytesSplit is in the following format:
-	// bytesString: {name} {number of samples} 'samples' [{units}] {minimum} {maximum} {sum}
-	// bytesSplit:   [0]    [1]                 [2]       [3]       [4]       [5]       [6]
-	metricMap[operation+"_samples_total"] = map[string]string{"help": samplesHelp, "value": bytesSplit[1]}
-	metricMap[operation+"_minimum_size_bytes"] = map[string]string{"help": minimumHelp, "value": bytesSplit[4]}
-	metricMap[operation+"_maximum_size_bytes"] = map[string]string{"help": maximumHelp, "value": bytesSplit[5]}
-	metricMap[operation+"_total_bytes"] = map[string]string{"help": totalHelp, "value": bytesSplit[6]}
+// emitRate sends the per-second rate of a counter in place of its value.
+func (s *lustreSource) emitRate(nodeType string, nodeName string, name string, helpText string, value float64, now time.Time, ch chan<- prometheus.Metric) {
+	if rate, ok := s.rates.rate(nodeType+"/"+nodeName+"/"+name, value, now); ok {
+		labels, labelValues := targetLabels(nodeType, nodeName)
+		ch <- s.gaugeMetric(name+"_per_second", "Per-second rate of: "+helpText, labels, rate, labelValues...)
+	}
+}
 
-	return metricMap, nil
+// mgsFilesystems reports each filesystem managed by the MGS, as listed by the
+// entries under mgs/MGS/live. The 'params' entry holds global parameters
+// rather than a filesystem and is skipped.
+func (s *lustreSource) mgsFilesystems(ch chan<- prometheus.Metric) error {
+	paths, err := filepath.Glob(filepath.Join(s.basePaths[procTree], "mgs/*/live/*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fsName := filepath.Base(path)
+		if fsName == "params" {
+			continue
+		}
+		ch <- s.gaugeMetric("mgs_filesystem_info", "Filesystems managed by the MGS", []string{"fs_name"}, 1, fsName)
+	}
+	return nil
+}
+
+// logParseError logs a failure to parse path, suppressing repeats of the same
+// error so a persistently unparseable file doesn't flood the log.
+func (s *lustreSource) logParseError(path string, err error) {
+	now := time.Now()
+	collectErrors.record(path, err, now)
+	ok, suppressed := s.errorLog.shouldLog(path+": "+err.Error(), now)
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		log.Errorf("Couldn't parse %s: %s (%d identical errors suppressed)", path, err, suppressed)
+		return
+	}
+	log.Errorf("Couldn't parse %s: %s", path, err)
+}
+
+// logPermissionProblems warns at startup about files the exporter can see
+// but not read, so missing metrics are explained when running without root.
+func (s *lustreSource) logPermissionProblems() {
+	unreadable := make(map[string][]string)
+	for _, metric := range s.lustreProcMetrics {
+		paths, err := s.globMetric(metric)
+		if err != nil {
+			continue
+		}
+		for _, path := range paths {
+			f, err := os.Open(path)
+			if err != nil {
+				if os.IsPermission(err) {
+					unreadable[metric.source] = append(unreadable[metric.source], path)
+				}
+				continue
+			}
+			f.Close()
+		}
+	}
+	for source, paths := range unreadable {
+		log.Warnf("%d %s files are unavailable due to permissions: %s", len(paths), source, strings.Join(paths, ", "))
+	}
+}
+
+// globMetric returns the files matching metric in the tree(s) it lives in.
+func (s *lustreSource) globMetric(metric lustreProcMetric) (paths []string, err error) {
+	trees := []sourceTree{metric.tree}
+	if metric.tree == procAndSysfsTree {
+		trees = []sourceTree{procTree, sysfsTree}
+	}
+	for _, path := range append([]string{metric.path}, metric.fallbacks...) {
+		for _, tree := range trees {
+			paths, err = filepath.Glob(filepath.Join(s.basePaths[tree], path, metric.name))
+			if err != nil || paths != nil {
+				return paths, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// ossFallbackPaths returns the directories other Lustre versions keep an
+// obdfilter file in. Capacity files are also reported by the OSD layer.
+func ossFallbackPaths(path string, name string) []string {
+	if path != "obdfilter/*" {
+		return nil
+	}
+	if capacityMetrics[name] {
+		return []string{"ost/*-OST*", "osd-ldiskfs/*-OST*", "osd-zfs/*-OST*"}
+	}
+	return []string{"ost/*-OST*"}
+}
+
+// statsEntry holds the fields of a single data line from a Lustre 'stats' file.
+type statsEntry struct {
+	name   string
+	fields []string
+}
+
+// parseStatsEntries returns every data line of a 'stats' file. Data lines are
+// in the format {name} {number of samples} 'samples' [{units}] ...; header
+// lines such as snapshot_time, blank lines, and trailing whitespace are ignored.
+func parseStatsEntries(statsFile string) (entries []statsEntry) {
+	for _, line := range strings.Split(statsFile, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		fields := statsFieldSeparator.Split(line, -1)
+		if len(fields) < 3 || fields[2] != "samples" {
+			continue
+		}
+		if _, err := strconv.ParseUint(fields[1], 10, 64); err != nil {
+			continue
+		}
+		entries = append(entries, statsEntry{name: fields[0], fields: fields})
+	}
+	return entries
+}
+
+// statsLines parses a 'stats' file in a single pass into its data lines,
+// keyed by the name in the first column.
+func statsLines(statsFile string) map[string]statsEntry {
+	lines := make(map[string]statsEntry)
+	for _, entry := range parseStatsEntries(statsFile) {
+		lines[entry.name] = entry
+	}
+	return lines
+}
+
+// parseStatsEntry converts a single line of a 'stats' file into values named
+// after the operation, in the base units of statsUnits, e.g.
+// setattr_total_seconds. The *_bytes lines keep their historical names, e.g.
+// read_minimum_size_bytes for read_bytes.
+func parseStatsEntry(entry statsEntry) (operation string, stats []operationStat, err error) {
+	operation = entry.name
+	unit, hasUnit := entry.unit()
+	if hasUnit && unit.name == "bytes" {
+		operation = strings.TrimSuffix(operation, "_bytes")
+	}
+	stats, err = entry.operationStats(operation)
+	if err != nil {
+		return "", nil, err
+	}
+	for i := range stats {
+		switch stats[i].name {
+		case operation + "_minimum_bytes":
+			stats[i].name = operation + "_minimum_size_bytes"
+		case operation + "_maximum_bytes":
+			stats[i].name = operation + "_maximum_size_bytes"
+		}
+	}
+	return operation, stats, nil
 }
 
 func splitBRWStats(title string, statBlock string) (metricMap map[string]map[string]string, err error) {
@@ -236,6 +1047,9 @@ func splitBRWStats(title string, statBlock string) (metricMap map[string]map[str
 			// Lines are in the following format:
 			// [size] [# read RPCs] [relative read size (%)] [cumulative read size (%)] | [# write RPCs] [relative write size (%)] [cumulative write size (%)]
 			// [0]    [1]           [2]                      [3]                       [4] [5]           [6]                       [7]
+			if len(fields) < 6 {
+				return nil, fmt.Errorf("expected at least 6 fields in %s line %q, got %d", title, line, len(fields))
+			}
 			size, readRPCs, writeRPCs := fields[0], fields[1], fields[5]
 			size = strings.Replace(size, ":", "", -1)
 			metricMap[title+"_"+size+"_read"] = map[string]string{"value": readRPCs, "size": size, "operation": "read", "name": title}
@@ -245,37 +1059,6 @@ func splitBRWStats(title string, statBlock string) (metricMap map[string]map[str
 	return metricMap, nil
 }
 
-func parseStatsFile(path string) (metricMap map[string]map[string]string, err error) {
-	metricMap = make(map[string]map[string]string)
-	statsFileBytes, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	statsFile := string(statsFileBytes[:])
-
-	readStatsMap, err := parseReadWriteBytes("read", "read_bytes .*", statsFile)
-	if err != nil {
-		return nil, err
-	}
-	if readStatsMap != nil {
-		for key, value := range readStatsMap {
-			metricMap[key] = value
-		}
-	}
-
-	writeStatsMap, err := parseReadWriteBytes("write", "write_bytes .*", statsFile)
-	if err != nil {
-		return nil, err
-	}
-	if writeStatsMap != nil {
-		for key, value := range writeStatsMap {
-			metricMap[key] = value
-		}
-	}
-
-	return metricMap, nil
-}
-
 func extractStatsBlock(title string, statsFile string) (block string) {
 	// The following expressions match the specified block in the text or the end of the string,
 	// whichever comes first.
@@ -288,8 +1071,8 @@ func extractStatsBlock(title string, statsFile string) (block string) {
 func parseFileElements(path string) (name string, nodeName string, err error) {
 	pathElements := strings.Split(path, "/")
 	pathLen := len(pathElements)
-	if pathLen < 1 {
-		return "", "", fmt.Errorf("path did not return at least one element")
+	if pathLen < 2 {
+		return "", "", fmt.Errorf("path %q did not return at least two elements", path)
 	}
 	name = pathElements[pathLen-1]
 	nodeName = pathElements[pathLen-2]
@@ -330,65 +1113,196 @@ func (s *lustreSource) parseBRWStats(nodeType string, metricType string, path st
 	return nil
 }
 
-func (s *lustreSource) parseFile(nodeType string, metricType string, path string, helpText string, handler func(string, string, string, string, uint64)) (err error) {
-	name, nodeName, err := parseFileElements(path)
+// parseRPCsInFlight reads the current number of read and write RPCs in
+// flight from the 'read RPCs in flight' and 'write RPCs in flight' header
+// lines of an osc rpc_stats file.
+func (s *lustreSource) parseRPCsInFlight(nodeType string, path string, handler func(string, string, string, uint64)) (err error) {
+	_, nodeName, err := parseFileElements(path)
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
-	switch metricType {
-	case "single":
-		value, err := ioutil.ReadFile(path)
+	values := parseKeyValueFile(string(contents))
+	for _, direction := range []string{"read", "write"} {
+		raw, ok := values[direction+" RPCs in flight"]
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseUint(raw, 10, 64)
 		if err != nil {
 			return err
 		}
-		convertedValue, err := strconv.ParseUint(strings.TrimSpace(string(value)), 10, 64)
+		handler(nodeType, nodeName, direction, value)
+	}
+	return nil
+}
+
+// split returns the raw value(s) held in contents according to the layout,
+// keyed by the metric name each should be exported as.
+func (l valueLayout) split(name string, contents string) (values map[string]string, err error) {
+	if l.field == 0 && len(l.names) == 0 {
+		return map[string]string{name: contents}, nil
+	}
+	fields := strings.Fields(contents)
+	values = make(map[string]string)
+	if len(l.names) == 0 {
+		if l.field > len(fields) {
+			return nil, fmt.Errorf("expected at least %d values, got %d", l.field, len(fields))
+		}
+		values[name] = fields[l.field-1]
+		return values, nil
+	}
+	for i, suffix := range l.names {
+		if suffix == "" {
+			continue
+		}
+		if i >= len(fields) {
+			return nil, fmt.Errorf("expected at least %d values, got %d", i+1, len(fields))
+		}
+		values[name+"_"+suffix] = fields[i]
+	}
+	return values, nil
+}
+
+// parseSingleValue converts the contents of a single-value proc file into a
+// number, normalizing known placeholders such as "disabled" or "[0]". skip is
+// true when the value is a placeholder that has no numeric meaning.
+func parseSingleValue(raw string) (value uint64, skip bool, err error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "[") && strings.HasSuffix(raw, "]") {
+		raw = strings.TrimSpace(raw[1 : len(raw)-1])
+	}
+	if sentinel, ok := sentinelValues[raw]; ok {
+		return sentinel.value, sentinel.skip, nil
+	}
+	value, err = strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return value, false, nil
+}
+
+// readSingleFile reads a single-value file, serving slowly-changing capacity
+// values from the cache when one is configured.
+func (s *lustreSource) readSingleFile(name string, path string) ([]byte, error) {
+	if s.capacityCache != nil && capacityMetrics[name] {
+		return s.capacityCache.readFile(path, time.Now())
+	}
+	return ioutil.ReadFile(path)
+}
+
+func (s *lustreSource) parseFile(nodeType string, path string, helpText string, layout valueLayout, handler func(string, string, string, string, float64)) (err error) {
+	name, nodeName, err := parseFileElements(path)
+	if err != nil {
+		return err
+	}
+	value, err := s.readSingleFile(name, path)
+	if err != nil {
+		return err
+	}
+	values, err := layout.split(name, string(value))
+	if err != nil {
+		return err
+	}
+	for metricName, raw := range values {
+		convertedValue, skip, err := parseSingleValue(raw)
 		if err != nil {
 			return err
 		}
-		handler(nodeType, nodeName, name, helpText, convertedValue)
-	case "stats":
-		metricMap, err := parseStatsFile(path)
+		if skip {
+			skippedValues.WithLabelValues(metricName).Inc()
+			continue
+		}
+		handler(nodeType, nodeName, metricName, helpText, float64(convertedValue))
+	}
+	return nil
+}
+
+// parseStats passes each value of a 'stats' file to handler along with the
+// operation it belongs to and its name relative to that operation. Every data
+// line is parsed, so operations added by newer releases are exported without
+// changes here.
+func (s *lustreSource) parseStats(nodeType string, nodeName string, statsFile string, handler func(string, string, string, string, string, string, prometheus.ValueType, float64)) (err error) {
+	seen := make(map[string]bool)
+	for _, entry := range parseStatsEntries(statsFile) {
+		if !operationAllowed(s.statsOperations, entry.name) {
+			continue
+		}
+		operation, stats, err := parseStatsEntry(entry)
 		if err != nil {
 			return err
 		}
-
-		for key, statMap := range metricMap {
-			value, err := strconv.ParseUint(statMap["value"], 10, 64)
-			if err != nil {
-				return err
+		// Newer releases report read and write latency on separate read and
+		// write lines. Their sample counts match read_bytes and write_bytes,
+		// so whichever line comes first provides read_samples_total.
+		for _, stat := range stats {
+			if seen[stat.name] {
+				continue
 			}
-			handler(nodeType, nodeName, key, statMap["help"], value)
+			seen[stat.name] = true
+			handler(nodeType, nodeName, operation, strings.TrimPrefix(stat.name, operation+"_"), stat.name, stat.helpText, stat.valueType, stat.value)
 		}
 	}
 	return nil
 }
 
-func (s *lustreSource) constMetric(nodeType string, nodeName string, name string, helpText string, value uint64) prometheus.Metric {
+func (s *lustreSource) parseInfoFile(nodeType string, path string, helpText string, handler func(string, string, string, string, string)) (err error) {
+	name, nodeName, err := parseFileElements(path)
+	if err != nil {
+		return err
+	}
+	value, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	handler(nodeType, nodeName, name, helpText, strings.TrimSpace(string(value)))
+	return nil
+}
+
+func (s *lustreSource) constMetric(nodeType string, nodeName string, name string, helpText string, valueType prometheus.ValueType, value float64) prometheus.Metric {
+	labels, labelValues := targetLabels(nodeType, nodeName)
 	return prometheus.MustNewConstMetric(
 		prometheus.NewDesc(
 			prometheus.BuildFQName(Namespace, "", name),
 			helpText,
-			[]string{nodeType},
+			labels,
 			nil,
 		),
-		prometheus.CounterValue,
-		float64(value),
-		nodeName,
+		valueType,
+		value,
+		labelValues...,
+	)
+}
+
+func (s *lustreSource) infoMetric(nodeType string, nodeName string, name string, helpText string, value string) prometheus.Metric {
+	labels, labelValues := targetLabels(nodeType, nodeName)
+	return prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", name+"_info"),
+			helpText,
+			append(labels, "value"),
+			nil,
+		),
+		prometheus.GaugeValue,
+		1,
+		append(labelValues, value)...,
 	)
 }
 
 func (s *lustreSource) brwMetric(nodeType string, brwOperation string, brwSize string, nodeName string, name string, helpText string, value uint64) prometheus.Metric {
+	labels, labelValues := targetLabels(nodeType, nodeName)
 	return prometheus.MustNewConstMetric(
 		prometheus.NewDesc(
 			prometheus.BuildFQName(Namespace, "", name),
 			helpText,
-			[]string{nodeType, "operation", "size"},
+			append(labels, "operation", "size"),
 			nil,
 		),
 		prometheus.CounterValue,
 		float64(value),
-		nodeName,
-		brwOperation,
-		brwSize,
+		append(labelValues, brwOperation, brwSize)...,
 	)
 }
@@ -0,0 +1,601 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A node running several services exports the same metric names from
+// different templates, which must agree on type and help.
+func TestUpdateCombinedNodeGathers(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, combinedFixture)
+	setBoolFlag(t, exportsEnabled, true)
+	setBoolFlag(t, quotaEnabled, true)
+	_, registry := newFixtureSource(t, root)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %s", err)
+	}
+	seen := make(map[string]bool)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			pairs := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				pairs = append(pairs, label.GetName()+"="+label.GetValue())
+			}
+			sort.Strings(pairs)
+			key := family.GetName() + "{" + strings.Join(pairs, ",") + "}"
+			if seen[key] {
+				t.Errorf("duplicate series %s", key)
+			}
+			seen[key] = true
+		}
+	}
+	for _, name := range []string{"lustre_degraded", "lustre_blocksize", "lustre_target_uuid_info", "lustre_open_files_in_use"} {
+		found := false
+		for _, family := range families {
+			found = found || family.GetName() == name
+		}
+		if !found {
+			t.Errorf("%s missing from the combined node", name)
+		}
+	}
+}
+
+// Once --collector.procfs-timeout passes, no further files are read but the
+// timeout is still reported.
+func TestUpdateTimeoutSkipsCollectors(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, combinedFixture)
+	saved := *procfsTimeout
+	*procfsTimeout = time.Nanosecond
+	t.Cleanup(func() { *procfsTimeout = saved })
+	_, registry := newFixtureSource(t, root)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %s", err)
+	}
+	timedOut := false
+	for _, family := range families {
+		switch family.GetName() {
+		case "lustre_scrape_timed_out":
+			timedOut = family.GetMetric()[0].GetGauge().GetValue() == 1
+		case "lustre_target_up", "lustre_import_available_connections", "lustre_degraded":
+			t.Errorf("%s collected after the timeout", family.GetName())
+		}
+	}
+	if !timedOut {
+		t.Error("lustre_scrape_timed_out not set")
+	}
+}
+
+// Other Lustre versions keep the obdfilter files of an OST in ost/ or, for
+// capacity files, in the OSD directory. obdfilter is preferred when present.
+func TestOSSFallbackLayouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		metric string
+		value  float64
+		found  bool
+	}{
+		{
+			name:   "obdfilter",
+			files:  map[string]string{"proc/obdfilter/lustrefs-OST0000/kbytestotal": "100\n"},
+			metric: "lustre_kbytestotal",
+			value:  100,
+			found:  true,
+		},
+		{
+			name:   "ost",
+			files:  map[string]string{"proc/ost/lustrefs-OST0000/kbytestotal": "200\n"},
+			metric: "lustre_kbytestotal",
+			value:  200,
+			found:  true,
+		},
+		{
+			name:   "osd-ldiskfs",
+			files:  map[string]string{"proc/osd-ldiskfs/lustrefs-OST0000/kbytestotal": "300\n"},
+			metric: "lustre_kbytestotal",
+			value:  300,
+			found:  true,
+		},
+		{
+			name:   "osd-zfs",
+			files:  map[string]string{"proc/osd-zfs/lustrefs-OST0000/kbytestotal": "400\n"},
+			metric: "lustre_kbytestotal",
+			value:  400,
+			found:  true,
+		},
+		{
+			name: "obdfilter preferred",
+			files: map[string]string{
+				"proc/obdfilter/lustrefs-OST0000/kbytestotal": "100\n",
+				"proc/osd-zfs/lustrefs-OST0000/kbytestotal":   "400\n",
+			},
+			metric: "lustre_kbytestotal",
+			value:  100,
+			found:  true,
+		},
+		{
+			name:   "ost non-capacity",
+			files:  map[string]string{"proc/ost/lustrefs-OST0000/degraded": "1\n"},
+			metric: "lustre_degraded",
+			value:  1,
+			found:  true,
+		},
+		{
+			name:   "osd non-capacity ignored",
+			files:  map[string]string{"proc/osd-ldiskfs/lustrefs-OST0000/degraded": "1\n"},
+			metric: "lustre_degraded",
+			found:  false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFixture(t, root, test.files)
+			_, registry := newFixtureSource(t, root)
+			value, found := gatherValue(t, registry, test.metric, map[string]string{"OSS": "lustrefs-OST0000"})
+			if found != test.found || value != test.value {
+				t.Errorf("%s = %v (found %v), want %v (found %v)", test.metric, value, found, test.value, test.found)
+			}
+		})
+	}
+}
+
+// ostFixture returns a tree of n OSTs, each with the obdfilter files of the
+// OST in combinedFixture.
+func ostFixture(n int) map[string]string {
+	const prefix = "proc/obdfilter/lustrefs-OST0000/"
+	files := make(map[string]string)
+	for i := 0; i < n; i++ {
+		dir := fmt.Sprintf("proc/obdfilter/lustrefs-OST%04x/", i)
+		for name, contents := range combinedFixture {
+			if strings.HasPrefix(name, prefix) {
+				files[dir+strings.TrimPrefix(name, prefix)] = contents
+			}
+		}
+	}
+	return files
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	for _, osts := range []int{50, 500} {
+		b.Run(fmt.Sprintf("%d-osts", osts), func(b *testing.B) {
+			root := b.TempDir()
+			writeFixture(b, root, ostFixture(osts))
+			useFixturePaths(b, root)
+			source, err := NewLustreSource()
+			if err != nil {
+				b.Fatal(err)
+			}
+			ch := make(chan prometheus.Metric)
+			go func() {
+				for range ch {
+				}
+			}()
+			defer close(ch)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := source.Update(context.Background(), ch); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSingleValue(t *testing.T) {
+	tests := []struct {
+		raw   string
+		value uint64
+		skip  bool
+		err   bool
+	}{
+		{raw: "disabled\n", value: 0},
+		{raw: "enabled\n", value: 1},
+		{raw: "off", value: 0},
+		{raw: "on", value: 1},
+		{raw: "N/A\n", skip: true},
+		{raw: "none", skip: true},
+		{raw: "[0]\n", value: 0},
+		{raw: "[enabled]", value: 1},
+		{raw: "  42 \n", value: 42},
+		{raw: "unknown", err: true},
+	}
+	for _, test := range tests {
+		value, skip, err := parseSingleValue(test.raw)
+		if (err != nil) != test.err {
+			t.Errorf("parseSingleValue(%q) error = %v, want error %v", test.raw, err, test.err)
+			continue
+		}
+		if value != test.value || skip != test.skip {
+			t.Errorf("parseSingleValue(%q) = %d, %v, want %d, %v", test.raw, value, skip, test.value, test.skip)
+		}
+	}
+}
+
+func TestValueLayoutSplit(t *testing.T) {
+	tests := []struct {
+		layout   valueLayout
+		contents string
+		want     map[string]string
+		err      bool
+	}{
+		{layout: valueLayout{}, contents: "42\n", want: map[string]string{"max": "42\n"}},
+		{layout: valueLayout{field: 1}, contents: "5 Sec\n", want: map[string]string{"max": "5"}},
+		{layout: valueLayout{field: 2}, contents: "5 10", want: map[string]string{"max": "10"}},
+		{layout: valueLayout{names: []string{"current", "default"}}, contents: "5 10\n", want: map[string]string{"max_current": "5", "max_default": "10"}},
+		{layout: valueLayout{names: []string{"", "default"}}, contents: "5 10", want: map[string]string{"max_default": "10"}},
+		{layout: valueLayout{field: 2}, contents: "5", err: true},
+		{layout: valueLayout{names: []string{"current", "default"}}, contents: "5", err: true},
+	}
+	for _, test := range tests {
+		values, err := test.layout.split("max", test.contents)
+		if (err != nil) != test.err {
+			t.Errorf("split(%q) with %+v error = %v, want error %v", test.contents, test.layout, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(values, test.want) {
+			t.Errorf("split(%q) with %+v = %v, want %v", test.contents, test.layout, values, test.want)
+		}
+	}
+}
+
+// qos_maxage holds a value followed by its unit; only the value is exported.
+func TestMultiValueFile(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, combinedFixture)
+	_, registry := newFixtureSource(t, root)
+
+	value, ok := gatherValue(t, registry, "lustre_qos_maxage", map[string]string{"MDS": "lustrefs-MDT0000-mdtlov"})
+	if !ok {
+		t.Fatal("lustre_qos_maxage missing")
+	}
+	if value != 5 {
+		t.Errorf("lustre_qos_maxage = %v, want 5", value)
+	}
+}
+
+func TestParseStatsEntries(t *testing.T) {
+	statsFile := "snapshot_time             1499896316.294447271 secs.nsecs\n" +
+		"start_time                1499890000.000000000 secs.nsecs\n" +
+		"elapsed_time              6316.294447271 secs.nsecs\n" +
+		"\n" +
+		"read_bytes                4 samples [bytes] 4096 1048576 1052672   \n" +
+		"\n" +
+		"   write_bytes 2 samples [bytes] 8 8 16\t\n" +
+		"statfs                    7 samples [reqs]\n" +
+		"\n\n"
+	want := []statsEntry{
+		{name: "read_bytes", fields: []string{"read_bytes", "4", "samples", "[bytes]", "4096", "1048576", "1052672"}},
+		{name: "write_bytes", fields: []string{"write_bytes", "2", "samples", "[bytes]", "8", "8", "16"}},
+		{name: "statfs", fields: []string{"statfs", "7", "samples", "[reqs]"}},
+	}
+	if got := parseStatsEntries(statsFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseStatsEntries() = %v, want %v", got, want)
+	}
+}
+
+// Every path pattern, including the fallbacks, must be a valid glob.
+func TestMetricTemplatePatterns(t *testing.T) {
+	var s lustreSource
+	generators := map[string]func() error{
+		"OSS":    s.generateOSSMetricTemplates,
+		"MGS":    s.generateMGSMetricTemplates,
+		"MDS":    s.generateMDSMetricTemplates,
+		"echo":   s.generateEchoMetricTemplates,
+		"client": s.generateClientMetricTemplates,
+	}
+	for name, generate := range generators {
+		s.lustreProcMetrics = nil
+		if err := generate(); err != nil {
+			t.Fatalf("generating %s templates: %s", name, err)
+		}
+		if len(s.lustreProcMetrics) == 0 {
+			t.Errorf("no %s templates generated", name)
+		}
+		for _, metric := range s.lustreProcMetrics {
+			for _, path := range append([]string{metric.path}, metric.fallbacks...) {
+				pattern := filepath.Join(path, metric.name)
+				if _, err := filepath.Match(pattern, ""); err != nil {
+					t.Errorf("%s template %q has invalid pattern %q: %s", name, metric.name, pattern, err)
+				}
+			}
+		}
+	}
+}
+
+// Some vendor builds separate the fields of 'stats' files with tabs.
+func TestTabDelimitedStats(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"proc/obdfilter/lustrefs-OST0000/stats": "snapshot_time\t1499896316.294447271\tsecs.nsecs\n" +
+			"read_bytes\t4\tsamples\t[bytes]\t4096\t1048576\t1052672\n" +
+			"write_bytes \t2\t samples\t[bytes] 8\t8\t16\t\n" +
+			"statfs\t\t7\tsamples\t[reqs]\n",
+	})
+	_, registry := newFixtureSource(t, root)
+	labels := map[string]string{"OSS": "lustrefs-OST0000"}
+	for name, want := range map[string]float64{
+		"lustre_read_samples_total":   4,
+		"lustre_read_total_bytes":     1052672,
+		"lustre_write_samples_total":  2,
+		"lustre_write_total_bytes":    16,
+		"lustre_statfs_samples_total": 7,
+	} {
+		if value, found := gatherValue(t, registry, name, labels); !found || value != want {
+			t.Errorf("%s = %v (found %v), want %v", name, value, found, want)
+		}
+	}
+}
+
+// Latency lines are reported in seconds whichever spelling of the unit the
+// release uses.
+func TestStatsLatencySeconds(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"proc/obdfilter/lustrefs-OST0000/stats": "snapshot_time 1.0 secs.usecs\n" +
+			"read 4 samples [usec] 10 20 50\n" +
+			"setattr 2 samples [usecs] 100 300 400\n",
+	})
+	_, registry := newFixtureSource(t, root)
+	labels := map[string]string{"OSS": "lustrefs-OST0000"}
+	for name, want := range map[string]float64{
+		"lustre_read_samples_total":      4,
+		"lustre_read_maximum_seconds":    20e-6,
+		"lustre_read_total_seconds":      50e-6,
+		"lustre_setattr_minimum_seconds": 100e-6,
+		"lustre_setattr_total_seconds":   400e-6,
+	} {
+		if value, found := gatherValue(t, registry, name, labels); !found || math.Abs(value-want) > 1e-12 {
+			t.Errorf("%s = %v (found %v), want %v", name, value, found, want)
+		}
+	}
+}
+
+// Derived metrics are labeled like the metrics they are computed from.
+func TestDerivedMetricLabels(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, combinedFixture)
+	_, registry := newFixtureSource(t, root)
+	for _, name := range []string{"lustre_inodes_low", "lustre_ost_space_low", "lustre_ost_grant_used_ratio", "lustre_kbytesused"} {
+		if _, found := gatherValue(t, registry, name, map[string]string{"OSS": "lustrefs-OST0000"}); !found {
+			t.Errorf("%s{OSS=\"lustrefs-OST0000\"} not found", name)
+		}
+	}
+	if _, found := gatherValue(t, registry, "lustre_osp_precreate_remaining", map[string]string{"MDS": "lustrefs-OST0000-osc-MDT0000"}); !found {
+		t.Error("lustre_osp_precreate_remaining{MDS=\"lustrefs-OST0000-osc-MDT0000\"} not found")
+	}
+}
+
+func TestBRWRPCsTotalLabels(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, combinedFixture)
+	_, registry := newFixtureSource(t, root)
+	for _, direction := range []string{"read", "write"} {
+		if _, found := gatherValue(t, registry, "lustre_brw_rpcs_total", map[string]string{"OSS": "lustrefs-OST0000", "direction": direction}); !found {
+			t.Errorf("lustre_brw_rpcs_total{OSS=\"lustrefs-OST0000\",direction=%q} not found", direction)
+		}
+	}
+}
+
+// Metrics from the collectors outside the templates use the same target
+// labels as the template metrics of the same target.
+func TestCollectorTargetLabels(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, combinedFixture)
+	setBoolFlag(t, exportsEnabled, true)
+	setBoolFlag(t, quotaEnabled, true)
+	_, registry := newFixtureSource(t, root)
+	tests := []struct {
+		name   string
+		labels map[string]string
+	}{
+		{"lustre_target_up", map[string]string{"OSS": "lustrefs-OST0000"}},
+		{"lustre_target_up", map[string]string{"MDS": "lustrefs-MDT0000"}},
+		{"lustre_target_uuid_info", map[string]string{"OSS": "lustrefs-OST0000", "uuid": "lustrefs-OST0000_UUID"}},
+		{"lustre_export_held_locks", map[string]string{"OSS": "lustrefs-OST0000", "nid": "10.0.0.1@tcp"}},
+		{"lustre_quota_used_bytes", map[string]string{"OSS": "lustrefs-OST0000", "type": "project", "id": "1500"}},
+		{"lustre_osd_objects_free", map[string]string{"OSS": "lustrefs-OST0000", "backend": "zfs"}},
+		{"lustre_mdt_lock_count", map[string]string{"MDS": "lustrefs-MDT0000"}},
+		{"lustre_mdt_capa_count", map[string]string{"MDS": "lustrefs-MDT0000", "site": "server"}},
+		{"lustre_lod_ost_active", map[string]string{"MDS": "lustrefs-MDT0000", "ost": "lustrefs-OST0001"}},
+		{"lustre_import_active_connections", map[string]string{"target": "lustrefs-OST0000-osc-ffff88", "component": "osc"}},
+	}
+	for _, test := range tests {
+		if _, found := gatherValue(t, registry, test.name, test.labels); !found {
+			t.Errorf("%s%v not found", test.name, test.labels)
+		}
+	}
+}
+
+// brw_stats has no sums, so they are estimated from the bucket midpoints.
+func TestBRWHistogramSums(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, combinedFixture)
+	_, registry := newFixtureSource(t, root)
+	tests := []struct {
+		name      string
+		operation string
+		sum       float64
+	}{
+		// 5 RPCs of 1 page at 0.5, 5 of 256 at (1+256)/2.
+		{"lustre_brw_pages_per_rpc", "read", 5*0.5 + 5*128.5},
+		// 3 I/Os of 1ms at 0.5ms, 7 of 4ms at 2.5ms.
+		{"lustre_brw_io_time_seconds", "read", 3*0.0005 + 7*0.0025},
+		// 10 I/Os of 1M at (4K+1M)/2.
+		{"lustre_brw_disk_io_size_bytes", "write", 10 * (4096 + 1048576) / 2},
+	}
+	for _, test := range tests {
+		sum, found := gatherValue(t, registry, test.name, map[string]string{"OSS": "lustrefs-OST0000", "operation": test.operation})
+		if !found {
+			t.Errorf("%s{operation=%q} not found", test.name, test.operation)
+			continue
+		}
+		if math.Abs(sum-test.sum) > 1e-9 {
+			t.Errorf("%s{operation=%q} sum = %v, want %v", test.name, test.operation, sum, test.sum)
+		}
+	}
+}
+
+// A target is up while its stats count new requests; a snapshot_time that
+// advances on every read does not count as progress.
+func TestTargetUpActivity(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, combinedFixture)
+	saved := *targetStaleAfter
+	*targetStaleAfter = 10 * time.Millisecond
+	t.Cleanup(func() { *targetStaleAfter = saved })
+	_, registry := newFixtureSource(t, root)
+	labels := map[string]string{"OSS": "lustrefs-OST0000"}
+	statsPath := "proc/obdfilter/lustrefs-OST0000/stats"
+
+	steps := []struct {
+		stats string
+		up    float64
+	}{
+		{stats: "snapshot_time 1.0 secs.usecs\nread 4 samples [usec] 10 20 50\n", up: 1},
+		{stats: "snapshot_time 2.0 secs.usecs\nread 4 samples [usec] 10 20 50\n", up: 0},
+		{stats: "snapshot_time 3.0 secs.usecs\nread 5 samples [usec] 10 20 60\n", up: 1},
+	}
+	for i, step := range steps {
+		if i > 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		writeFixture(t, root, map[string]string{statsPath: step.stats})
+		value, found := gatherValue(t, registry, "lustre_target_up", labels)
+		if !found {
+			t.Fatalf("step %d: lustre_target_up%v not found", i, labels)
+		}
+		if value != step.up {
+			t.Errorf("step %d: lustre_target_up = %v, want %v", i, value, step.up)
+		}
+	}
+}
+
+// Adaptive timeout estimates belong to a service, not a target, so they are
+// labeled by service and estimate only.
+func TestTimeoutLabels(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, combinedFixture)
+	_, registry := newFixtureSource(t, root)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %s", err)
+	}
+	services := make(map[string]bool)
+	for _, family := range families {
+		if family.GetName() != "lustre_at_current_seconds" && family.GetName() != "lustre_at_worst_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			names := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				names = append(names, label.GetName())
+				if label.GetName() == "service" {
+					services[label.GetValue()] = true
+				}
+			}
+			if !reflect.DeepEqual(names, []string{"estimate", "service"}) {
+				t.Errorf("%s labeled %v, want [estimate service]", family.GetName(), names)
+			}
+		}
+	}
+	for _, service := range []string{"ost_io", "mdt"} {
+		if !services[service] {
+			t.Errorf("no adaptive timeout series for service %q", service)
+		}
+	}
+}
+
+// Rate-only gauges carry the same target labels as the counters they replace.
+func TestRateOnlyLabels(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, combinedFixture)
+	setBoolFlag(t, targetIndexLabel, true)
+	saved := *rateOnlyMetrics
+	*rateOnlyMetrics = "read_samples_total"
+	t.Cleanup(func() { *rateOnlyMetrics = saved })
+	_, registry := newFixtureSource(t, root)
+
+	gatherValue(t, registry, "lustre_read_samples_total", nil)
+	time.Sleep(10 * time.Millisecond)
+	if _, found := gatherValue(t, registry, "lustre_read_samples_total_per_second", map[string]string{"OSS": "lustrefs-OST0000", "index": "0"}); !found {
+		t.Error("lustre_read_samples_total_per_second{OSS=\"lustrefs-OST0000\",index=\"0\"} not found")
+	}
+	if _, found := gatherValue(t, registry, "lustre_read_samples_total", map[string]string{"OSS": "lustrefs-OST0000", "index": "0"}); found {
+		t.Error("lustre_read_samples_total exported alongside its rate")
+	}
+}
+
+// MDT and OST job_stats label jobs the same way, as job_id.
+func TestJobStatsLabels(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, combinedFixture)
+	_, registry := newFixtureSource(t, root)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %s", err)
+	}
+	jobs := make(map[string]bool)
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "lustre_job_") {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "jobid" {
+					t.Errorf("%s is labeled jobid", family.GetName())
+				}
+				if label.GetName() == "job_id" {
+					jobs[label.GetValue()] = true
+				}
+			}
+		}
+	}
+	for _, job := range []string{"bash.0", "dd.1", "slurm.1234", "dd.0"} {
+		if !jobs[job] {
+			t.Errorf("no job_stats series for job_id %q", job)
+		}
+	}
+}
+
+// Malformed input is reported as an error rather than a panic.
+func TestMalformedInputErrors(t *testing.T) {
+	block := "pages per bulk r/w     rpcs  % cum % |  rpcs        % cum %\n1:\t\t 12  50  50   |\n"
+	if _, err := splitBRWStats("pages per bulk r/w", block); err == nil {
+		t.Error("splitBRWStats accepted a line with too few fields")
+	}
+	for _, path := range []string{"", "stats"} {
+		if _, _, err := parseFileElements(path); err == nil {
+			t.Errorf("parseFileElements(%q) returned no error", path)
+		}
+	}
+}
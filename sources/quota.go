@@ -0,0 +1,162 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	quotaEnabled = flag.Bool("collector.quota", false, "Collect per-id quota usage from the quota accounting files of each target.")
+	quotaTypes   = flag.String("quota.types", "project", "Comma-separated quota types to collect: user, group and/or project.")
+	quotaIDRange = flag.String("quota.id-range", "", "Only collect quota ids in this inclusive range, e.g. 1000-2000, 1000- or -999; empty collects all ids.")
+
+	// quotaAccountingFiles maps quota types to their accounting file below
+	// the quota_slave directory of an OSD target.
+	quotaAccountingFiles = map[string]string{
+		"user":    "acct_user",
+		"group":   "acct_group",
+		"project": "acct_project",
+	}
+
+	// quotaUsageRegex matches the usage line of an accounting entry, e.g.
+	//   usage:   { inodes:                  209, kbytes:             2616 }
+	quotaUsageRegex = regexp.MustCompile(`usage:\s*\{\s*inodes:\s*(\d+),\s*kbytes:\s*(\d+)\s*\}`)
+)
+
+// idRange is an inclusive range of quota ids.
+type idRange struct {
+	min uint64
+	max uint64
+}
+
+// parseIDRange parses ranges like "1000-2000", "1000-" or "-999". An empty
+// string selects every id.
+func parseIDRange(value string) (r idRange, err error) {
+	r = idRange{min: 0, max: ^uint64(0)}
+	if value == "" {
+		return r, nil
+	}
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) != 2 {
+		return r, fmt.Errorf("quota.id-range must be in the form min-max, got %q", value)
+	}
+	if parts[0] != "" {
+		if r.min, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+			return r, fmt.Errorf("invalid quota.id-range %q: %s", value, err)
+		}
+	}
+	if parts[1] != "" {
+		if r.max, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+			return r, fmt.Errorf("invalid quota.id-range %q: %s", value, err)
+		}
+	}
+	if r.min > r.max {
+		return r, fmt.Errorf("quota.id-range %q is empty", value)
+	}
+	return r, nil
+}
+
+func (r idRange) contains(id uint64) bool {
+	return id >= r.min && id <= r.max
+}
+
+// quotaUsage is the usage of a single quota id on a target.
+type quotaUsage struct {
+	id     uint64
+	inodes uint64
+	kbytes uint64
+}
+
+// parseQuotaAccounting parses a quota accounting file, keeping only the ids
+// in ids.
+func parseQuotaAccounting(contents string, ids idRange) (usages []quotaUsage, err error) {
+	var id uint64
+	hasID := false
+	for _, line := range strings.Split(contents, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "- id:") {
+			id, err = strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(trimmed, "- id:")), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			hasID = true
+			continue
+		}
+		match := quotaUsageRegex.FindStringSubmatch(trimmed)
+		if match == nil || !hasID || !ids.contains(id) {
+			continue
+		}
+		usage := quotaUsage{id: id}
+		if usage.inodes, err = strconv.ParseUint(match[1], 10, 64); err != nil {
+			return nil, err
+		}
+		if usage.kbytes, err = strconv.ParseUint(match[2], 10, 64); err != nil {
+			return nil, err
+		}
+		usages = append(usages, usage)
+		hasID = false
+	}
+	return usages, nil
+}
+
+// quotaMetrics exports the usage of each quota id in the configured range
+// for every target and quota type.
+func (s *lustreSource) quotaMetrics(ch chan<- prometheus.Metric) error {
+	if !*quotaEnabled {
+		return nil
+	}
+	for quotaType := range s.quotaTypes {
+		for dir := range osdBackends {
+			paths, err := filepath.Glob(filepath.Join(s.basePaths[procTree], dir, "*", "quota_slave", quotaAccountingFiles[quotaType]))
+			if err != nil {
+				return err
+			}
+			for _, path := range paths {
+				target := filepath.Base(filepath.Dir(filepath.Dir(path)))
+				if !s.targets.allowed(target) {
+					continue
+				}
+				contents, err := ioutil.ReadFile(path)
+				if err != nil {
+					if os.IsNotExist(err) || os.IsPermission(err) {
+						continue
+					}
+					return err
+				}
+				usages, err := parseQuotaAccounting(string(contents), s.quotaIDs)
+				if err != nil {
+					return err
+				}
+				labels, labelValues := serverTargetLabels(target)
+				labels = append(labels, "type", "id")
+				for _, usage := range usages {
+					values := append(labelValues, quotaType, strconv.FormatUint(usage.id, 10))
+					ch <- s.gaugeMetric("quota_used_inodes", "Number of inodes used on the target by the quota id", labels, float64(usage.inodes), values...)
+					ch <- s.gaugeMetric("quota_used_bytes", "Number of bytes used on the target by the quota id", labels, float64(usage.kbytes*1024), values...)
+				}
+			}
+		}
+	}
+	return nil
+}
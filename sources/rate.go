@@ -0,0 +1,74 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	rateOnlyMetrics = flag.String("rate-only-metrics", "", "Comma-separated list of counter names to expose only as a per-second rate gauge (<name>_per_second), dropping the raw counter.")
+)
+
+type counterSample struct {
+	value     float64
+	timestamp time.Time
+}
+
+// rateTracker remembers the previous value of each counter so a per-second
+// rate can be computed between scrapes.
+type rateTracker struct {
+	mu      sync.Mutex
+	samples map[string]counterSample
+}
+
+func newRateTracker() *rateTracker {
+	return &rateTracker{samples: make(map[string]counterSample)}
+}
+
+// rate records value for key and returns the per-second rate since the
+// previous sample. ok is false on the first sample for a key. A value lower
+// than the previous one is treated as a counter reset.
+func (r *rateTracker) rate(key string, value float64, now time.Time) (rate float64, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous, ok := r.samples[key]
+	r.samples[key] = counterSample{value: value, timestamp: now}
+	if !ok {
+		return 0, false
+	}
+	elapsed := now.Sub(previous.timestamp).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	if value < previous.value {
+		return value / elapsed, true
+	}
+	return (value - previous.value) / elapsed, true
+}
+
+// parseNameList splits a comma-separated flag value into a set of names.
+func parseNameList(list string) map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
@@ -0,0 +1,44 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"io/ioutil"
+	"strconv"
+)
+
+// parseRecoveryStatus reports the time_remaining of a recovery_status file
+// while the target is recovering. Nothing is reported once recovery is
+// complete or when the timer hasn't started.
+func (s *lustreSource) parseRecoveryStatus(nodeType string, path string, handler func(string, string, uint64)) (err error) {
+	_, nodeName, err := parseFileElements(path)
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	values := parseKeyValueFile(string(contents))
+	remaining, ok := values["time_remaining"]
+	if values["status"] != "RECOVERING" || !ok {
+		return nil
+	}
+	value, err := strconv.ParseUint(remaining, 10, 64)
+	if err != nil {
+		return err
+	}
+	handler(nodeType, nodeName, value)
+	return nil
+}
@@ -0,0 +1,189 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// The routes file starts with the routing state of this node:
+	// Routing enabled
+	// net      hops priority state router
+	// o2ib        1        0    up 192.168.1.1@o2ib
+	lnetRouteColumns = []lnetColumn{
+		{header: "hops", name: "route_hops", helpText: "Number of hops to the remote network through the router"},
+		{header: "priority", name: "route_priority", helpText: "Priority of the route to the remote network through the router; lower is preferred"},
+	}
+	// The buffers file lists every router buffer pool once per CPT:
+	// pages count credits     min
+	//     0   512     512     510
+	lnetBufferColumns = []lnetColumn{
+		{header: "count", name: "router_buffers", helpText: "Number of buffers in the router buffer pool"},
+		{header: "credits", name: "router_buffer_credits", helpText: "Number of buffers currently available in the router buffer pool"},
+		{header: "min", name: "router_buffer_min_credits", helpText: "Lowest number of buffers ever available in the router buffer pool"},
+	}
+	// Older releases report ping details in the routers file:
+	// ref rtr_ref alive_cnt state last_ping ping_sent deadline down_ni router
+	lnetRouterPingColumns = []lnetColumn{
+		{header: "alive_cnt", name: "router_alive_count", helpText: "Number of times the router has come back alive"},
+		{header: "last_ping", name: "router_last_ping_seconds", helpText: "Number of seconds since the router was last pinged"},
+		{header: "down_ni", name: "router_down_nis", helpText: "Number of network interfaces of the router reported down"},
+	}
+)
+
+func init() {
+	Factories["lnet_router"] = NewLNETRouterSource
+}
+
+// lnetRouterSource exports the routing table and router buffers, which are
+// only of interest on LNET routers and nodes that route through them.
+type lnetRouterSource struct {
+	lnetSource
+}
+
+func NewLNETRouterSource() (LustreSource, error) {
+	var l lnetRouterSource
+	l.basePath = procFilePath("sys", "lnet")
+	return &l, nil
+}
+
+func (s *lnetRouterSource) Update(ctx context.Context, ch chan<- prometheus.Metric) (err error) {
+	if err := s.updateRoutes(ch); err != nil {
+		return err
+	}
+	if err := s.updateRouterPings(ch); err != nil {
+		return err
+	}
+	return s.updateBuffers(ch)
+}
+
+// updateRoutes exports whether this node routes, and the state, hops and
+// priority of every route labeled by remote network and router.
+func (s *lnetRouterSource) updateRoutes(ch chan<- prometheus.Metric) error {
+	routesFile, ok, err := s.readLNETFile("routes")
+	if err != nil || !ok {
+		return err
+	}
+	lines := strings.Split(routesFile, "\n")
+	ch <- s.lnetGauge("routing_enabled", "Whether this node routes LNET messages for other nodes (1) or not (0)", nil, boolToFloat(strings.TrimSpace(lines[0]) == "Routing enabled"))
+	if len(lines) < 2 {
+		return nil
+	}
+	header := strings.Fields(lines[1])
+	indexes, err := columnIndexes("routes", header, append(lnetRouteColumns, lnetColumn{header: "net"}, lnetColumn{header: "state"}, lnetColumn{header: "router"}))
+	if err != nil {
+		return err
+	}
+	netColumn, stateColumn, routerColumn := indexes[len(lnetRouteColumns)], indexes[len(lnetRouteColumns)+1], indexes[len(lnetRouteColumns)+2]
+	for _, line := range lines[2:] {
+		fields := strings.Fields(line)
+		if len(fields) != len(header) {
+			continue
+		}
+		labelValues := []string{fields[netColumn], fields[routerColumn]}
+		for _, metric := range enumMetrics(s.lnetMetricName("route_state"), "State of the route to the remote network through the router, 1 for the current state", []string{"net", "router"}, labelValues, []string{"up", "down"}, fields[stateColumn]) {
+			ch <- metric
+		}
+		for i, column := range lnetRouteColumns {
+			value, err := strconv.ParseFloat(fields[indexes[i]], 64)
+			if err != nil {
+				return err
+			}
+			ch <- s.lnetGauge(column.name, column.helpText, []string{"net", "router"}, value, labelValues...)
+		}
+	}
+	return nil
+}
+
+// updateRouterPings exports the router checker's ping details where the
+// routers file has them. Newer releases only list the router state, which
+// the lnet source exports.
+func (s *lnetRouterSource) updateRouterPings(ch chan<- prometheus.Metric) error {
+	routersFile, ok, err := s.readLNETFile("routers")
+	if err != nil || !ok {
+		return err
+	}
+	lines := strings.Split(routersFile, "\n")
+	header := strings.Fields(lines[0])
+	indexes, err := columnIndexes("routers", header, append(lnetRouterPingColumns, lnetColumn{header: "router"}))
+	if err != nil {
+		return nil
+	}
+	routerColumn := indexes[len(lnetRouterPingColumns)]
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != len(header) {
+			continue
+		}
+		for i, column := range lnetRouterPingColumns {
+			value, err := strconv.ParseFloat(fields[indexes[i]], 64)
+			if err != nil {
+				return err
+			}
+			ch <- s.lnetGauge(column.name, column.helpText, []string{"nid"}, value, fields[routerColumn])
+		}
+	}
+	return nil
+}
+
+// bufferPool names a router buffer pool after the number of pages in each
+// of its buffers.
+func bufferPool(pages string) string {
+	switch pages {
+	case "0":
+		return "tiny"
+	case "1":
+		return "small"
+	}
+	return "large"
+}
+
+// updateBuffers exports the router buffer pools labeled by pool and by CPT,
+// numbered in the order the file lists them.
+func (s *lnetRouterSource) updateBuffers(ch chan<- prometheus.Metric) error {
+	buffersFile, ok, err := s.readLNETFile("buffers")
+	if err != nil || !ok {
+		return err
+	}
+	lines := strings.Split(buffersFile, "\n")
+	header := strings.Fields(lines[0])
+	indexes, err := columnIndexes("buffers", header, append(lnetBufferColumns, lnetColumn{header: "pages"}))
+	if err != nil {
+		return err
+	}
+	pagesColumn := indexes[len(lnetBufferColumns)]
+	cpts := make(map[string]int)
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != len(header) {
+			continue
+		}
+		pool := bufferPool(fields[pagesColumn])
+		cpt := strconv.Itoa(cpts[pool])
+		cpts[pool]++
+		for i, column := range lnetBufferColumns {
+			value, err := strconv.ParseFloat(fields[indexes[i]], 64)
+			if err != nil {
+				return err
+			}
+			ch <- s.lnetGauge(column.name, column.helpText, []string{"pool", "cpt"}, value, pool, cpt)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// collectorEvery maps the expensive collectors to how often they run.
+	// Between runs the metrics from their last run are sent again.
+	collectorEvery = map[string]*int{
+		"job_stats": flag.Int("collector.job-stats.every", 1, "Read job_stats files only every Nth scrape, re-sending the last values in between."),
+		"brw_stats": flag.Int("collector.brw-stats.every", 1, "Read brw_stats files only every Nth scrape, re-sending the last values in between."),
+		"exports":   flag.Int("collector.exports.every", 1, "Read the exports directories only every Nth scrape, re-sending the last values in between."),
+	}
+)
+
+type sampledResult struct {
+	collector string
+	scrapes   int
+	scheduled time.Time
+	interval  time.Duration //Time between the last two scrapes that scheduled the key
+	collected time.Time
+	metrics   []prometheus.Metric
+}
+
+// collectorScheduler runs expensive collectors only every Nth scrape and
+// caches their metrics for the scrapes in between.
+type collectorScheduler struct {
+	mu      sync.Mutex
+	results map[string]*sampledResult
+}
+
+func newCollectorScheduler() *collectorScheduler {
+	return &collectorScheduler{results: make(map[string]*sampledResult)}
+}
+
+// collectMetrics runs collect and returns the metrics it sent. The channel
+// is closed even if collect panics, so the goroutine reading it always exits.
+func collectMetrics(collect func(chan<- prometheus.Metric) error) (metrics []prometheus.Metric, err error) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric, 1)
+	go func() {
+		var metrics []prometheus.Metric
+		for metric := range ch {
+			metrics = append(metrics, metric)
+		}
+		done <- metrics
+	}()
+	func() {
+		defer close(ch)
+		err = collect(ch)
+	}()
+	return <-done, err
+}
+
+// run sends the metrics of the collector identified by key to ch, running
+// collect on every Nth call for the named collector and sending the metrics
+// of its last run otherwise. A failed run is retried on the next scrape.
+func (c *collectorScheduler) run(collector string, key string, now time.Time, ch chan<- prometheus.Metric, collect func(chan<- prometheus.Metric) error) error {
+	every := 1
+	if n, ok := collectorEvery[collector]; ok {
+		every = *n
+	}
+	if every <= 1 {
+		return collect(ch)
+	}
+	c.mu.Lock()
+	result, found := c.results[key]
+	if !found {
+		result = &sampledResult{collector: collector}
+		c.results[key] = result
+	}
+	due := result.metrics == nil || result.scrapes%every == 0
+	result.scrapes++
+	if now.After(result.scheduled) {
+		if !result.scheduled.IsZero() {
+			result.interval = now.Sub(result.scheduled)
+		}
+		result.scheduled = now
+	}
+	c.mu.Unlock()
+
+	if due {
+		metrics, err := collectMetrics(collect)
+		if err != nil {
+			for _, metric := range metrics {
+				ch <- metric
+			}
+			return err
+		}
+		c.mu.Lock()
+		result.metrics = metrics
+		result.collected = now
+		c.mu.Unlock()
+	}
+	c.mu.Lock()
+	metrics := result.metrics
+	c.mu.Unlock()
+	for _, metric := range metrics {
+		ch <- metric
+	}
+	return nil
+}
+
+// maxAge returns the age of the oldest cached result of each sampled
+// collector. Results of keys that have not been scheduled for longer than
+// their scrape interval, such as targets that went away, are dropped first.
+// Keys scheduled only once use the longest interval seen for their
+// collector. Judging by age rather than by the scrape's own time keeps
+// overlapping scrapes from evicting each other's results.
+func (c *collectorScheduler) maxAge(now time.Time) map[string]time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	intervals := make(map[string]time.Duration)
+	for _, result := range c.results {
+		if result.interval > intervals[result.collector] {
+			intervals[result.collector] = result.interval
+		}
+	}
+	ages := make(map[string]time.Duration)
+	for key, result := range c.results {
+		interval := result.interval
+		if interval == 0 {
+			interval = intervals[result.collector]
+		}
+		if interval > 0 && now.Sub(result.scheduled) > interval {
+			delete(c.results, key)
+			continue
+		}
+		if age := now.Sub(result.collected); result.metrics != nil && age > ages[result.collector] {
+			ages[result.collector] = age
+		}
+	}
+	return ages
+}
@@ -0,0 +1,99 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func setCollectorEvery(t *testing.T, collector string, every int) {
+	saved := *collectorEvery[collector]
+	*collectorEvery[collector] = every
+	t.Cleanup(func() { *collectorEvery[collector] = saved })
+}
+
+func testCollect(ch chan<- prometheus.Metric) error {
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc("test", "test", nil, nil), prometheus.GaugeValue, 1)
+	return nil
+}
+
+func TestSchedulerEvictsUnscheduledKeys(t *testing.T) {
+	setCollectorEvery(t, "brw_stats", 2)
+	scheduler := newCollectorScheduler()
+	discard := make(chan prometheus.Metric, 10)
+	first := time.Unix(100, 0)
+	for _, key := range []string{"brw_stats:a", "brw_stats:b"} {
+		if err := scheduler.run("brw_stats", key, first, discard, testCollect); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scheduler.maxAge(first)
+
+	// brw_stats:b has been missing for one scrape interval: kept.
+	second := first.Add(time.Minute)
+	if err := scheduler.run("brw_stats", "brw_stats:a", second, discard, testCollect); err != nil {
+		t.Fatal(err)
+	}
+	ages := scheduler.maxAge(second)
+	if ages["brw_stats"] != time.Minute {
+		t.Errorf("brw_stats age = %s, want 1m", ages["brw_stats"])
+	}
+	if _, ok := scheduler.results["brw_stats:b"]; !ok {
+		t.Error("result of brw_stats:b was evicted after a single missed scrape")
+	}
+
+	// Missing for longer than the interval: evicted.
+	third := second.Add(time.Minute)
+	if err := scheduler.run("brw_stats", "brw_stats:a", third, discard, testCollect); err != nil {
+		t.Fatal(err)
+	}
+	scheduler.maxAge(third)
+	if _, ok := scheduler.results["brw_stats:b"]; ok {
+		t.Error("result of brw_stats:b was not evicted")
+	}
+}
+
+// A scrape finishing after an overlapping, later scrape rescheduled its keys
+// keeps their results.
+func TestSchedulerOverlappingScrapes(t *testing.T) {
+	setCollectorEvery(t, "brw_stats", 2)
+	scheduler := newCollectorScheduler()
+	discard := make(chan prometheus.Metric, 10)
+	first := time.Unix(100, 0)
+	for _, now := range []time.Time{first, first.Add(time.Minute), first.Add(time.Minute + time.Second)} {
+		if err := scheduler.run("brw_stats", "brw_stats:a", now, discard, testCollect); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scheduler.maxAge(first.Add(time.Minute))
+	if _, ok := scheduler.results["brw_stats:a"]; !ok {
+		t.Error("result of brw_stats:a was evicted by an overlapping scrape")
+	}
+}
+
+// A panicking collector still closes the channel its metrics are read from.
+func TestCollectMetricsPanic(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("collectMetrics did not propagate the panic")
+		}
+	}()
+	collectMetrics(func(ch chan<- prometheus.Metric) error {
+		testCollect(ch)
+		panic("collector failed")
+	})
+}
@@ -0,0 +1,105 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	slabinfoPath = flag.String("path.slabinfo", "", "Path of the kernel slabinfo file used for MDS cache metrics (default <path.procfs>/slabinfo).")
+
+	// mdsCaches lists the slab caches backing the metadata server's lock,
+	// object and inode caches.
+	mdsCaches = map[string]bool{
+		"ldlm_locks":          true,
+		"ldlm_resources":      true,
+		"mdt_obj":             true,
+		"mdd_obj":             true,
+		"lod_obj":             true,
+		"osp_obj":             true,
+		"ldiskfs_inode_cache": true,
+	}
+)
+
+// slabCache holds the usage of a single slab cache as reported by slabinfo.
+type slabCache struct {
+	activeObjects uint64
+	objects       uint64
+	objectSize    uint64
+}
+
+// parseSlabinfo returns the usage of every cache in names found in a
+// slabinfo file. Lines are in the following format:
+// {name} {active_objs} {num_objs} {objsize} {objperslab} {pagesperslab} : ...
+func parseSlabinfo(contents string, names map[string]bool) (caches map[string]slabCache, err error) {
+	caches = make(map[string]slabCache)
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !names[fields[0]] {
+			continue
+		}
+		var values [3]uint64
+		for i := range values {
+			values[i], err = strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		caches[fields[0]] = slabCache{activeObjects: values[0], objects: values[1], objectSize: values[2]}
+	}
+	return caches, nil
+}
+
+// mdsCacheMetrics exports the size of the metadata caches on nodes running an
+// MDT.
+func (s *lustreSource) mdsCacheMetrics(ch chan<- prometheus.Metric) error {
+	mdts, err := filepath.Glob(filepath.Join(s.basePaths[procTree], "mdt/*"))
+	if err != nil || len(mdts) == 0 {
+		return err
+	}
+	path := *slabinfoPath
+	if path == "" {
+		path = procFilePath("slabinfo")
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if os.IsPermission(err) {
+			log.Debugf("Skipping %s: %s", path, err)
+			permissionErrors.WithLabelValues("procfs").Inc()
+			return nil
+		}
+		return err
+	}
+	caches, err := parseSlabinfo(string(contents), mdsCaches)
+	if err != nil {
+		return err
+	}
+	for name, cache := range caches {
+		ch <- s.gaugeMetric("mds_cache_active_objects", "Number of objects in use in the MDS metadata cache", []string{"cache"}, float64(cache.activeObjects), name)
+		ch <- s.gaugeMetric("mds_cache_bytes", "Memory in bytes allocated to the MDS metadata cache", []string{"cache"}, float64(cache.objects*cache.objectSize), name)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var statsSnapshotStaleness = flag.Bool("stats.snapshot-staleness", false, "Also export how long the snapshot_time of each stats file has not advanced as lustre_stats_snapshot_stale_seconds.")
+
+// parseSnapshotTime returns the snapshot_time of a stats file in seconds. ok
+// is false if the file has none. Older releases separate the value with
+// spaces, newer ones with a colon:
+// snapshot_time             1499896316.294447271 secs.nsecs
+// snapshot_time: 1499896316.294447271 secs.nsecs
+func parseSnapshotTime(statsFile string) (snapshot float64, ok bool, err error) {
+	for _, line := range strings.Split(statsFile, "\n") {
+		fields := strings.Fields(strings.Replace(line, ":", " ", 1))
+		if len(fields) < 2 || fields[0] != "snapshot_time" {
+			continue
+		}
+		snapshot, err = strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return 0, false, err
+		}
+		return snapshot, true, nil
+	}
+	return 0, false, nil
+}
+
+type snapshotSample struct {
+	value    float64
+	advanced time.Time
+}
+
+// stalenessTracker remembers when a value that only changes with progress,
+// such as the snapshot_time or the sample counts of a stats file, last
+// changed.
+type stalenessTracker struct {
+	mu      sync.Mutex
+	samples map[string]snapshotSample
+}
+
+func newStalenessTracker() *stalenessTracker {
+	return &stalenessTracker{samples: make(map[string]snapshotSample)}
+}
+
+// stale records value for key and returns how long ago it last changed. A
+// key seen for the first time has just changed, and so has one whose value
+// dropped, e.g. after its counters were reset.
+func (t *stalenessTracker) stale(key string, value float64, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sample, found := t.samples[key]
+	if !found || value != sample.value {
+		sample = snapshotSample{value: value, advanced: now}
+		t.samples[key] = sample
+	}
+	return now.Sub(sample.advanced)
+}
+
+// hasSnapshot reports whether files matched by metric start with a
+// snapshot_time header. job_stats only has one per job.
+func (metric lustreProcMetric) hasSnapshot() bool {
+	return metric.name == "stats" || (metric.opsPrefix != "" && metric.name != "job_stats")
+}
+
+// snapshotMetrics exports the snapshot_time of a stats file, labeled by the
+// target and the subsystem the file belongs to (obdfilter, mdt, osc, ...),
+// and with --stats.snapshot-staleness how long it has not advanced.
+func (s *lustreSource) snapshotMetrics(metric lustreProcMetric, nodeName string, statsFile string, now time.Time, ch chan<- prometheus.Metric) error {
+	snapshot, ok, err := parseSnapshotTime(statsFile)
+	if err != nil || !ok {
+		return err
+	}
+	subsystem := strings.SplitN(metric.path, "/", 2)[0]
+	labels, labelValues := targetLabels(metric.source, nodeName)
+	labels = append(labels, "subsystem")
+	labelValues = append(labelValues, subsystem)
+	ch <- s.gaugeMetric("stats_snapshot_timestamp_seconds", "Time the stats were sampled, from the snapshot_time of the stats file", labels, snapshot, labelValues...)
+	if *statsSnapshotStaleness {
+		stale := s.staleness.stale(subsystem+"/"+nodeName, snapshot, now)
+		ch <- s.gaugeMetric("stats_snapshot_stale_seconds", "Number of seconds since the snapshot_time of the stats file last advanced", labels, stale.Seconds(), labelValues...)
+	}
+	return nil
+}
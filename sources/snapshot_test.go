@@ -0,0 +1,115 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSnapshotMetrics(t *testing.T) {
+	tests := []struct {
+		name      string
+		metric    lustreProcMetric
+		nodeName  string
+		statsFile string
+		subsystem string
+		snapshot  float64
+		found     bool
+	}{
+		{
+			name:      "obdfilter",
+			metric:    newLustreProcMetric("stats", "OSS", "obdfilter/*", ""),
+			nodeName:  "lustrefs-OST0000",
+			statsFile: "snapshot_time             1499896316.294447271 secs.nsecs\nread_bytes 4 samples [bytes] 1 2 5\n",
+			subsystem: "obdfilter",
+			snapshot:  1499896316.294447271,
+			found:     true,
+		},
+		{
+			name:      "mdt with colon",
+			metric:    lustreProcMetric{name: "md_stats", source: "MDS", path: "mdt/*", opsPrefix: "md_stats"},
+			nodeName:  "lustrefs-MDT0000",
+			statsFile: "snapshot_time: 1499896316.5 secs.nsecs\nopen 5 samples [reqs]\n",
+			subsystem: "mdt",
+			snapshot:  1499896316.5,
+			found:     true,
+		},
+		{
+			name:      "osd-ldiskfs",
+			metric:    lustreProcMetric{name: "stats", source: "OSS", path: "osd-ldiskfs/*-OST*", opsPrefix: "osd_ldiskfs"},
+			nodeName:  "lustrefs-OST0000",
+			statsFile: "snapshot_time 12.25 secs.usecs\nget_page 7 samples [usec] 1 9 30\n",
+			subsystem: "osd-ldiskfs",
+			snapshot:  12.25,
+			found:     true,
+		},
+		{
+			name:      "osc",
+			metric:    lustreProcMetric{name: "stats", source: "target", path: "osc/*", opsPrefix: "osc"},
+			nodeName:  "lustrefs-OST0000-osc-ffff88",
+			statsFile: "snapshot_time 3 secs.usecs\n",
+			subsystem: "osc",
+			snapshot:  3,
+			found:     true,
+		},
+		{
+			name:      "no snapshot_time",
+			metric:    newLustreProcMetric("stats", "mount", "llite/*", ""),
+			nodeName:  "lustrefs-ffff88",
+			statsFile: "read_bytes 4 samples [bytes] 1 2 5\n",
+			found:     false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &lustreSource{staleness: newStalenessTracker()}
+			ch := make(chan prometheus.Metric, 10)
+			if err := s.snapshotMetrics(test.metric, test.nodeName, test.statsFile, time.Now(), ch); err != nil {
+				t.Fatal(err)
+			}
+			close(ch)
+			var metrics []prometheus.Metric
+			for metric := range ch {
+				metrics = append(metrics, metric)
+			}
+			if !test.found {
+				if len(metrics) != 0 {
+					t.Fatalf("got %d metrics, want none", len(metrics))
+				}
+				return
+			}
+			if len(metrics) != 1 {
+				t.Fatalf("got %d metrics, want 1", len(metrics))
+			}
+			var m dto.Metric
+			if err := metrics[0].Write(&m); err != nil {
+				t.Fatal(err)
+			}
+			if value := m.GetGauge().GetValue(); value != test.snapshot {
+				t.Errorf("snapshot = %v, want %v", value, test.snapshot)
+			}
+			labels := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["subsystem"] != test.subsystem || labels[test.metric.source] != test.nodeName {
+				t.Errorf("labels = %v, want subsystem %q and %s %q", labels, test.subsystem, test.metric.source, test.nodeName)
+			}
+		})
+	}
+}
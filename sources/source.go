@@ -14,6 +14,8 @@
 package sources
 
 import (
+	"context"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -21,8 +23,24 @@ const Namespace = "lustre"
 
 var Factories = make(map[string]func() (LustreSource, error))
 
+var (
+	permissionErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "exporter",
+			Name:      "permission_errors_total",
+			Help:      "Total number of files skipped because the exporter lacked permission to read them.",
+		},
+		[]string{"source"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(permissionErrors)
+}
+
 type LustreSource interface {
-	Update(ch chan<- prometheus.Metric) (err error)
+	Update(ctx context.Context, ch chan<- prometheus.Metric) (err error)
 }
 
 type typedDesc struct {
@@ -33,3 +51,19 @@ type typedDesc struct {
 func (d *typedDesc) mustNewConstMetric(value float64, labels ...string) prometheus.Metric {
 	return prometheus.MustNewConstMetric(d.desc, d.valueType, value, labels...)
 }
+
+// enumMetrics returns one gauge per possible state with an additional 'state'
+// label, set to 1 for the current state and 0 for the others.
+func enumMetrics(name string, helpText string, labels []string, labelValues []string, states []string, current string) []prometheus.Metric {
+	desc := prometheus.NewDesc(name, helpText, append(labels, "state"), nil)
+	metrics := make([]prometheus.Metric, 0, len(states))
+	for _, state := range states {
+		value := 0.0
+		if state == current {
+			value = 1
+		}
+		values := append(append([]string{}, labelValues...), state)
+		metrics = append(metrics, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, values...))
+	}
+	return metrics
+}
@@ -0,0 +1,139 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	statsNamingOperationMetric = "operation-metric"
+	statsNamingOperationLabel  = "operation-label"
+)
+
+var (
+	statsNaming     = flag.String("stats.naming", statsNamingOperationMetric, "Naming scheme for 'stats' file metrics: 'operation-metric' (lustre_read_samples_total) or 'operation-label' (lustre_stats_samples_total{operation=\"read\"}).")
+	statsOperations = flag.String("stats.operations", "", "Comma-separated list of stats file operations (e.g. read_bytes,open,unlink) to export; empty exports all operations.")
+)
+
+// operationAllowed reports whether metrics for the named stats operation
+// should be exported given the configured allow-list.
+func operationAllowed(operations map[string]bool, name string) bool {
+	return len(operations) == 0 || operations[name]
+}
+
+// statsUnit maps a unit found in a 'stats' file line onto a Prometheus base
+// unit, with the factor needed to convert values into it.
+type statsUnit struct {
+	name  string
+	scale float64
+}
+
+var statsUnits = map[string]statsUnit{
+	"bytes": {name: "bytes", scale: 1},
+	"usec":  {name: "seconds", scale: 1e-6},
+	"usecs": {name: "seconds", scale: 1e-6},
+	"reqs":  {name: "requests", scale: 1},
+	"pages": {name: "pages", scale: 1},
+	"locks": {name: "locks", scale: 1},
+}
+
+// operationStat is a single value derived from one line of a 'stats' file.
+type operationStat struct {
+	name      string
+	helpText  string
+	valueType prometheus.ValueType
+	value     float64
+}
+
+// unit returns the unit of the entry, or ok=false if the line has none.
+func (e statsEntry) unit() (unit statsUnit, ok bool) {
+	if len(e.fields) < 4 {
+		return statsUnit{}, false
+	}
+	name := strings.Trim(e.fields[3], "[]")
+	if unit, ok := statsUnits[name]; ok {
+		return unit, true
+	}
+	return statsUnit{name: name, scale: 1}, true
+}
+
+// operationStats converts an entry into values named after prefix and the
+// entry's unit, e.g. {prefix}_samples_total and {prefix}_total_seconds.
+func (e statsEntry) operationStats(prefix string) (stats []operationStat, err error) {
+	samples, err := strconv.ParseFloat(e.fields[1], 64)
+	if err != nil {
+		return nil, err
+	}
+	stats = append(stats, operationStat{name: prefix + "_samples_total", helpText: samplesHelp, valueType: prometheus.CounterValue, value: samples})
+
+	unit, ok := e.unit()
+	if !ok || len(e.fields) < 7 {
+		return stats, nil
+	}
+	// fields are in the following format:
+	// {name} {number of samples} 'samples' [{units}] {minimum} {maximum} {sum}
+	// [0]    [1]                 [2]       [3]       [4]       [5]       [6]
+	values := make([]float64, 3)
+	for i, field := range e.fields[4:7] {
+		values[i], err = strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] *= unit.scale
+	}
+	stats = append(stats,
+		operationStat{name: prefix + "_minimum_" + unit.name, helpText: minimumHelp, valueType: prometheus.GaugeValue, value: values[0]},
+		operationStat{name: prefix + "_maximum_" + unit.name, helpText: maximumHelp, valueType: prometheus.GaugeValue, value: values[1]},
+		operationStat{name: prefix + "_total_" + unit.name, helpText: totalHelp, valueType: prometheus.CounterValue, value: values[2]},
+	)
+	return stats, nil
+}
+
+// parseOperationStats exports every line of a 'stats' file under a common
+// metric prefix, labeled by the operation named on the line.
+func (s *lustreSource) parseOperationStats(nodeType string, prefix string, nodeName string, statsFile string, handler func(string, string, string, string, string, prometheus.ValueType, float64)) (err error) {
+	for _, entry := range parseStatsEntries(statsFile) {
+		if !operationAllowed(s.statsOperations, entry.name) {
+			continue
+		}
+		stats, err := entry.operationStats(prefix)
+		if err != nil {
+			return err
+		}
+		for _, stat := range stats {
+			handler(nodeType, nodeName, entry.name, stat.name, stat.helpText, stat.valueType, stat.value)
+		}
+	}
+	return nil
+}
+
+func (s *lustreSource) operationMetric(nodeType string, nodeName string, operation string, name string, helpText string, valueType prometheus.ValueType, value float64) prometheus.Metric {
+	labels, labelValues := targetLabels(nodeType, nodeName)
+	return prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", name),
+			helpText,
+			append(labels, "operation"),
+			nil,
+		),
+		valueType,
+		value,
+		append(labelValues, operation)...,
+	)
+}
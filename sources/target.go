@@ -0,0 +1,190 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	plainTargetLabel = flag.Bool("plain-target-label", false, "Label target metrics with 'target' instead of the node type (OSS, MDS, MGS), e.g. target=\"lustrefs-OST0000\" instead of OSS=\"lustrefs-OST0000\".")
+	targetIndexLabel = flag.Bool("target-index-label", false, "Add a numeric 'index' label derived from the OSTxxxx/MDTxxxx suffix of target names.")
+	excludeTargets   = flag.String("exclude-targets", "", "Regular expression of target names (e.g. lustrefs-OST0003) to skip; empty skips none.")
+	includeTargets   = flag.String("include-targets", "", "Regular expression of target names to collect; empty collects all.")
+	onlyTarget       = flag.String("target", "", "Only collect the target with this exact name (e.g. lustrefs-OST0007); empty collects all.")
+	backendLabel     = flag.Bool("backend-label", false, "Add a 'backend' label (ldiskfs or zfs) to target metrics, detected from the OSD directory of each target.")
+	targetAliasFile  = flag.String("target-alias-file", "", "File mapping target names to aliases exported as a 'target_alias' label, one 'target alias' pair per line.")
+
+	// targetAliases holds the mapping loaded from --target-alias-file.
+	targetAliases map[string]string
+
+	// targetBackends maps target names to their OSD backend, refreshed on
+	// every scrape when --backend-label is set.
+	targetBackends   = make(map[string]string)
+	targetBackendsMu sync.RWMutex
+
+	// targetNameRegex matches target names such as lustrefs-OST000a,
+	// optionally followed by a suffix like -osc-MDT0000.
+	targetNameRegex = regexp.MustCompile(`^(.+)-(OST|MDT)([0-9a-fA-F]{4})(-.*)?$`)
+
+	// targetNodeTypes maps the kind of a server target to the node type its
+	// template metrics are labeled with.
+	targetNodeTypes = map[string]string{
+		"OST": "OSS",
+		"MDT": "MDS",
+	}
+)
+
+// lustreTarget holds the components of a standard Lustre target name.
+type lustreTarget struct {
+	fsName string
+	kind   string //OST or MDT
+	index  uint64
+}
+
+// parseTargetName splits a target name like lustrefs-OST000a into its
+// filesystem name, target kind, and index. ok is false for names that do not
+// follow the standard format.
+func parseTargetName(name string) (target lustreTarget, ok bool) {
+	match := targetNameRegex.FindStringSubmatch(name)
+	if match == nil {
+		return lustreTarget{}, false
+	}
+	index, err := strconv.ParseUint(match[3], 16, 64)
+	if err != nil {
+		return lustreTarget{}, false
+	}
+	return lustreTarget{fsName: match[1], kind: match[2], index: index}, true
+}
+
+// targetLabels returns the label names and values identifying a target in
+// the metrics read from its files.
+func targetLabels(nodeType string, nodeName string) (names []string, values []string) {
+	names, values = []string{nodeType}, []string{nodeName}
+	if *plainTargetLabel {
+		names[0] = "target"
+	}
+	if *targetIndexLabel {
+		if target, ok := parseTargetName(nodeName); ok {
+			names = append(names, "index")
+			values = append(values, strconv.FormatUint(target.index, 10))
+		}
+	}
+	if *backendLabel {
+		targetBackendsMu.RLock()
+		backend, ok := targetBackends[nodeName]
+		targetBackendsMu.RUnlock()
+		if ok {
+			names = append(names, "backend")
+			values = append(values, backend)
+		}
+	}
+	if alias, ok := targetAliases[nodeName]; ok {
+		names = append(names, "target_alias")
+		values = append(values, alias)
+	}
+	return names, values
+}
+
+// serverTargetLabels returns the labels of an OST or MDT for the collectors
+// that read files outside the metric templates. The node type is derived from
+// the target name, so the series join with the template metrics of the same
+// target, e.g. OSS="lustrefs-OST0000". Other names are labeled 'target'.
+func serverTargetLabels(name string) (names []string, values []string) {
+	nodeType := "target"
+	if target, ok := parseTargetName(name); ok {
+		nodeType = targetNodeTypes[target.kind]
+	}
+	return targetLabels(nodeType, name)
+}
+
+// hasLabel reports whether name is one of the label names in names.
+func hasLabel(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// loadTargetAliases reads the target alias mapping from path. Blank lines and
+// lines starting with '#' are ignored.
+func loadTargetAliases(path string) (aliases map[string]string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	aliases = make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected 'target alias', got %q", path, lineNumber, line)
+		}
+		aliases[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+// targetFilter selects the targets collected by name.
+type targetFilter struct {
+	name    string
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// newTargetFilter compiles the include and exclude patterns. An empty pattern
+// is not applied. Patterns must match the whole target name. A non-empty name
+// restricts collection to that single target.
+func newTargetFilter(name string, include string, exclude string) (filter targetFilter, err error) {
+	filter.name = name
+	if include != "" {
+		if filter.include, err = regexp.Compile("^(?:" + include + ")$"); err != nil {
+			return targetFilter{}, fmt.Errorf("invalid include-targets pattern: %s", err)
+		}
+	}
+	if exclude != "" {
+		if filter.exclude, err = regexp.Compile("^(?:" + exclude + ")$"); err != nil {
+			return targetFilter{}, fmt.Errorf("invalid exclude-targets pattern: %s", err)
+		}
+	}
+	return filter, nil
+}
+
+// allowed reports whether the target should be collected.
+func (f targetFilter) allowed(name string) bool {
+	if f.name != "" && name != f.name {
+		return false
+	}
+	if f.include != nil && !f.include.MatchString(name) {
+		return false
+	}
+	return f.exclude == nil || !f.exclude.MatchString(name)
+}
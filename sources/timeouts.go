@@ -0,0 +1,82 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	atCurrentHelp string = "Current adaptive timeout service-time estimate in seconds."
+	atWorstHelp   string = "Worst adaptive timeout service-time estimate in seconds seen in the at_history window."
+)
+
+// atEstimateRegex matches adaptive timeout lines in a 'timeouts' file, e.g.
+// service : cur  33  worst  34 (at 1193427052, 0d0h26m40s ago)   1  1  33  2
+// The trailing values are the history buckets, which are not exported.
+var atEstimateRegex = regexp.MustCompile(`^(.+?)\s*:\s*cur\s+(\d+)\s+worst\s+(\d+)`)
+
+// parseTimeouts exports the current and worst adaptive timeout estimates for
+// each line of a 'timeouts' file, labeled by the service the file belongs to
+// (the directory it lives in, e.g. 'ost_io' or 'mdt') and by what the
+// estimate is for ('service', 'network', 'portal 6', ...).
+func (s *lustreSource) parseTimeouts(path string, handler func(string, string, string, string, float64)) (err error) {
+	_, service, err := parseFileElements(path)
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		match := atEstimateRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		current, err := strconv.ParseUint(match[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		worst, err := strconv.ParseUint(match[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		handler(service, match[1], "at_current_seconds", atCurrentHelp, float64(current))
+		handler(service, match[1], "at_worst_seconds", atWorstHelp, float64(worst))
+	}
+	return nil
+}
+
+// timeoutMetric labels an estimate by service rather than by target: the
+// services of a node are shared by all of its targets.
+func (s *lustreSource) timeoutMetric(service string, estimate string, name string, helpText string, value float64) prometheus.Metric {
+	return prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", name),
+			helpText,
+			[]string{"service", "estimate"},
+			nil,
+		),
+		prometheus.GaugeValue,
+		value,
+		service,
+		estimate,
+	)
+}
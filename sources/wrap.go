@@ -0,0 +1,73 @@
+// (C) Copyright 2017 Hewlett Packard Enterprise Development LP
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	counterWraparounds = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "counter_wraparound_total",
+			Help:      "Total number of times a 32-bit Lustre counter wrapped around and was extended by the exporter.",
+		},
+		[]string{"metric"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(counterWraparounds)
+}
+
+type wrapState struct {
+	last   uint64
+	offset uint64
+}
+
+// wrapTracker extends 32-bit counters to 64 bits. A value that drops after
+// the counter passed half of its 32-bit range is treated as a wraparound;
+// any other drop is a reset, such as a module reload. Counters that already
+// exceed 32 bits come from releases with 64-bit counters and never wrap.
+type wrapTracker struct {
+	mu     sync.Mutex
+	states map[string]*wrapState
+}
+
+func newWrapTracker() *wrapTracker {
+	return &wrapTracker{states: make(map[string]*wrapState)}
+}
+
+func (t *wrapTracker) extend(name string, value uint64) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, found := t.states[name]
+	if !found {
+		t.states[name] = &wrapState{last: value}
+		return value
+	}
+	if value < state.last {
+		if state.last >= 1<<31 && state.last < 1<<32 {
+			state.offset += 1 << 32
+			counterWraparounds.WithLabelValues(name).Inc()
+		} else {
+			state.offset = 0
+		}
+	}
+	state.last = value
+	return value + state.offset
+}